@@ -0,0 +1,163 @@
+// Package accounting turns recharge and invitation records into accounting
+// entries and writes them as CSV, OFX, beancount or ledger journals.
+package accounting
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+// Kind is the kind of record an entry comes from.
+type Kind string
+
+const (
+	Deposit Kind = "deposit"
+	Reward  Kind = "reward"
+)
+
+// Entry is a transaction moving Amount of Commodity from Counter to Account.
+type Entry struct {
+	// ID is derived from the record, so exporting it again gives the same ID
+	ID        string
+	Time      time.Time
+	Kind      Kind
+	Amount    float64
+	Commodity string
+	Chain     string
+	From, To  string // addresses of a deposit
+	Payee     string // invited user of a reward
+	Account   string
+	Counter   string
+}
+
+// Accounts maps keys to account names. A deposit uses the first of
+// "deposit:<chain>:<symbol>", "deposit:<symbol>", "deposit:<chain>" and
+// "deposit" that is set, and "transfer" as counter account; a reward uses
+// "reward:<unit>" or "reward", and "income". Names may contain the
+// placeholders {chain}, {symbol} and {unit}.
+type Accounts map[string]string
+
+// DefaultAccounts are used for keys not set otherwise.
+var DefaultAccounts = Accounts{
+	"deposit":  "Assets:Caitan:{chain}:{symbol}",
+	"transfer": "Equity:Transfers",
+	"reward":   "Assets:Caitan:Rewards",
+	"income":   "Income:Caitan:Referrals",
+}
+
+func (a Accounts) lookup(vars map[string]string, keys ...string) string {
+	for _, m := range []Accounts{a, DefaultAccounts} {
+		for _, k := range keys {
+			if name, ok := m[k]; ok {
+				for v, value := range vars {
+					name = strings.ReplaceAll(name, "{"+v+"}", value)
+				}
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// stableID hashes the fields identifying a record.
+func stableID(fields ...interface{}) string {
+	h := sha1.New()
+	for _, f := range fields {
+		fmt.Fprintf(h, "%v|", f)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func msTime(ms int64) time.Time {
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+}
+
+// Deposits converts recharge records, the date is the recharge time.
+func Deposits(records []client.RechargeRecord, accounts Accounts) []Entry {
+	entries := make([]Entry, 0, len(records))
+	for _, r := range records {
+		vars := map[string]string{"chain": r.Chain, "symbol": r.Symbol}
+		entries = append(entries, Entry{
+			ID:        stableID(Deposit, r.Chain, r.Symbol, r.RechargeFrom, r.RechargeTo, r.Amount, r.RechargeTime),
+			Time:      msTime(r.RechargeTime),
+			Kind:      Deposit,
+			Amount:    r.Amount,
+			Commodity: r.Symbol,
+			Chain:     r.Chain,
+			From:      r.RechargeFrom,
+			To:        r.RechargeTo,
+			Account: accounts.lookup(vars,
+				"deposit:"+r.Chain+":"+r.Symbol, "deposit:"+r.Symbol, "deposit:"+r.Chain, "deposit"),
+			Counter: accounts.lookup(vars, "transfer"),
+		})
+	}
+	return entries
+}
+
+// Rewards converts invitation records, the commodity is REWARD<unit>.
+func Rewards(records []client.InvitationRecord, accounts Accounts) []Entry {
+	entries := make([]Entry, 0, len(records))
+	for _, r := range records {
+		unit := strconv.Itoa(r.RewardUnit)
+		vars := map[string]string{"unit": unit}
+		entries = append(entries, Entry{
+			ID:        stableID(Reward, r.NickName, r.RewardType, r.RewardNumber, r.RewardUnit, r.RewardTime),
+			Time:      msTime(r.RewardTime),
+			Kind:      Reward,
+			Amount:    float64(r.RewardNumber),
+			Commodity: "REWARD" + unit,
+			Payee:     r.NickName,
+			Account:   accounts.lookup(vars, "reward:"+unit, "reward"),
+			Counter:   accounts.lookup(vars, "income"),
+		})
+	}
+	return entries
+}
+
+// Sort orders entries by time, then by ID.
+func Sort(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Time.Equal(entries[j].Time) {
+			return entries[i].Time.Before(entries[j].Time)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
+
+// Formats are the names accepted by Write.
+var Formats = []string{"csv", "ofx", "beancount", "ledger"}
+
+// Write writes entries in a format.
+func Write(w io.Writer, format string, entries []Entry) error {
+	switch format {
+	case "csv":
+		return WriteCSV(w, entries)
+	case "ofx":
+		return WriteOFX(w, entries, time.Now())
+	case "beancount":
+		return WriteBeancount(w, entries)
+	case "ledger":
+		return WriteLedger(w, entries)
+	}
+	return fmt.Errorf("unknown format %q, valid formats are %s", format, strings.Join(Formats, ", "))
+}
+
+func formatAmount(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// description is the narration of an entry.
+func (e Entry) description() string {
+	if e.Kind == Reward {
+		return "Invitation reward for " + e.Payee
+	}
+	return fmt.Sprintf("Deposit of %s %s on %s", formatAmount(e.Amount), e.Commodity, e.Chain)
+}
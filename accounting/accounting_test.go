@@ -0,0 +1,153 @@
+package accounting
+
+import (
+	"bytes"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+var (
+	recharges = []client.RechargeRecord{
+		{RechargeFrom: "TXfrom", RechargeTo: "TXto", Chain: "TRON", Amount: 30.5, Symbol: "USDT", RechargeTime: 1627392295000},
+		{RechargeFrom: "0xfrom", RechargeTo: "0xto", Chain: "ETH", Amount: 10, Symbol: "DAI", RechargeTime: 1627300000000},
+	}
+	invitations = []client.InvitationRecord{
+		{NickName: "alice", RewardType: 1, RewardNumber: 7, RewardUnit: 1, RewardTime: 1627478695000},
+	}
+)
+
+func entries(accounts Accounts) []Entry {
+	list := append(Deposits(recharges, accounts), Rewards(invitations, accounts)...)
+	for i := range list {
+		list[i].Time = list[i].Time.UTC()
+	}
+	Sort(list)
+	return list
+}
+
+func TestEntries(t *testing.T) {
+	list := entries(Accounts{"deposit:TRON:USDT": "Assets:Tron:USDT", "income": "Income:Referrals:{unit}"})
+	if len(list) != 3 || list[0].Commodity != "DAI" || list[2].Kind != Reward {
+		t.Fatalf("entries = %+v", list)
+	}
+	tests := []struct{ account, counter string }{
+		{"Assets:Caitan:ETH:DAI", "Equity:Transfers"},
+		{"Assets:Tron:USDT", "Equity:Transfers"},
+		{"Assets:Caitan:Rewards", "Income:Referrals:1"},
+	}
+	for i, tt := range tests {
+		if list[i].Account != tt.account || list[i].Counter != tt.counter {
+			t.Errorf("[%d] accounts = %s, %s, want %s, %s", i, list[i].Account, list[i].Counter, tt.account, tt.counter)
+		}
+	}
+	// IDs depend on the records only
+	again := entries(nil)
+	for i := range list {
+		if list[i].ID != again[i].ID {
+			t.Errorf("[%d] ID changed: %s, %s", i, list[i].ID, again[i].ID)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	list := entries(nil)
+	id := list[1].ID
+
+	var b bytes.Buffer
+	if err := Write(&b, "beancount", list); err != nil {
+		t.Fatal(err)
+	}
+	want := `2021-07-27 * "Deposit of 30.5 USDT on TRON"
+  id: "` + id + `"
+  from: "TXfrom"
+  to: "TXto"
+  Assets:Caitan:TRON:USDT  30.5 USDT
+  Equity:Transfers  -30.5 USDT
+`
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("beancount:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := Write(&b, "ledger", list); err != nil {
+		t.Fatal(err)
+	}
+	want = `2021/07/27 * (` + id + `) Deposit of 30.5 USDT on TRON
+    ; from: TXfrom
+    ; to: TXto
+    Assets:Caitan:TRON:USDT  30.5 USDT
+    Equity:Transfers
+`
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("ledger:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := Write(&b, "csv", list); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(b.String(), "\n"); lines != 4 {
+		t.Errorf("csv has %d lines:\n%s", lines, b.String())
+	}
+
+	b.Reset()
+	if err := WriteOFX(&b, list, time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	var doc ofxDocument
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("ofx: %s\n%s", err, b.String())
+	}
+	if len(doc.Statements) != 3 || doc.Statements[1].Transactions[0].ID != id {
+		t.Errorf("ofx:\n%s", b.String())
+	}
+
+	if err := Write(&b, "qif", list); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+// TestBeancountAccounts checks that every posting uses an account opened
+// before it, with components like Assets:My-Wallet.
+func TestBeancountAccounts(t *testing.T) {
+	list := entries(Accounts{"deposit": "assets:My Wallet:{chain}:{symbol}", "income": "Income:Referrals:{unit}"})
+	var b bytes.Buffer
+	if err := WriteBeancount(&b, list); err != nil {
+		t.Fatal(err)
+	}
+	component := regexp.MustCompile(`^[A-Z][A-Za-z0-9-]*$`)
+	opened := make(map[string]string)
+	date := ""
+	postings := 0
+	for _, line := range strings.Split(b.String(), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[1] == "open":
+			opened[fields[2]] = fields[0]
+		case len(fields) > 1 && fields[1] == "*":
+			date = fields[0]
+		case len(fields) == 3 && strings.HasPrefix(line, "  ") && !strings.HasSuffix(fields[0], ":"):
+			postings++
+			account := fields[0]
+			for _, c := range strings.Split(account, ":") {
+				if !component.MatchString(c) {
+					t.Errorf("account %s has the bad component %q", account, c)
+				}
+			}
+			if open, ok := opened[account]; !ok || open > date {
+				t.Errorf("account %s used on %s is opened on %q", account, date, open)
+			}
+		}
+	}
+	if postings != 2*len(list) {
+		t.Errorf("found %d postings, want %d:\n%s", postings, 2*len(list), b.String())
+	}
+	if _, ok := opened["Assets:My-Wallet:ETH:DAI"]; !ok {
+		t.Errorf("no sanitized deposit account:\n%s", b.String())
+	}
+}
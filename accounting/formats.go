@@ -0,0 +1,196 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteCSV writes one row per entry with a header.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "time", "kind", "amount", "commodity", "chain", "from", "to", "payee", "account", "counter"})
+	for _, e := range entries {
+		_ = cw.Write([]string{e.ID, e.Time.Format(time.RFC3339), string(e.Kind), formatAmount(e.Amount),
+			e.Commodity, e.Chain, e.From, e.To, e.Payee, e.Account, e.Counter})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// quote quotes a beancount string.
+func quote(s string) string {
+	return strconv.Quote(s)
+}
+
+// beancountAccount makes every component of an account name valid for
+// beancount: it starts with a capital letter and holds only letters, digits
+// and dashes. Other characters become dashes, a component not starting with a
+// letter gets an X in front.
+func beancountAccount(name string) string {
+	parts := strings.Split(name, ":")
+	for i, part := range parts {
+		b := []byte(strings.Trim(part, " "))
+		for j, c := range b {
+			if !isLetter(c) && !('0' <= c && c <= '9') && c != '-' {
+				b[j] = '-'
+			}
+		}
+		switch {
+		case len(b) == 0 || !isLetter(b[0]):
+			b = append([]byte("X"), b...)
+		case 'a' <= b[0] && b[0] <= 'z':
+			b[0] -= 'a' - 'A'
+		}
+		parts[i] = string(b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// WriteBeancount writes a beancount journal, the ID is kept in the id metadata.
+// Every account is opened on the day of the first entry.
+func WriteBeancount(w io.Writer, entries []Entry) error {
+	var (
+		first    time.Time
+		accounts []string
+		seen     = make(map[string]bool)
+	)
+	for _, e := range entries {
+		if first.IsZero() || e.Time.Before(first) {
+			first = e.Time
+		}
+		for _, a := range []string{beancountAccount(e.Account), beancountAccount(e.Counter)} {
+			if !seen[a] {
+				seen[a] = true
+				accounts = append(accounts, a)
+			}
+		}
+	}
+	for _, a := range accounts {
+		fmt.Fprintf(w, "%s open %s\n", first.Format("2006-01-02"), a)
+	}
+	if len(accounts) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, e := range entries {
+		amount := formatAmount(e.Amount)
+		fmt.Fprintf(w, "%s * %s\n", e.Time.Format("2006-01-02"), quote(e.description()))
+		fmt.Fprintf(w, "  id: %s\n", quote(e.ID))
+		if e.Kind == Deposit {
+			fmt.Fprintf(w, "  from: %s\n  to: %s\n", quote(e.From), quote(e.To))
+		}
+		fmt.Fprintf(w, "  %s  %s %s\n", beancountAccount(e.Account), amount, e.Commodity)
+		if _, err := fmt.Fprintf(w, "  %s  -%s %s\n\n", beancountAccount(e.Counter), amount, e.Commodity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteLedger writes a ledger-cli journal, the ID is the transaction code.
+func WriteLedger(w io.Writer, entries []Entry) error {
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s * (%s) %s\n", e.Time.Format("2006/01/02"), e.ID, e.description())
+		if e.Kind == Deposit {
+			fmt.Fprintf(w, "    ; from: %s\n    ; to: %s\n", e.From, e.To)
+		}
+		fmt.Fprintf(w, "    %s  %s %s\n", e.Account, formatAmount(e.Amount), e.Commodity)
+		if _, err := fmt.Fprintf(w, "    %s\n\n", e.Counter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	ID     string `xml:"FITID"`
+	Name   string `xml:"NAME"`
+	Memo   string `xml:"MEMO"`
+}
+
+type ofxStatement struct {
+	TrnUID       string           `xml:"TRNUID"`
+	Status       int              `xml:"STATUS>CODE"`
+	Severity     string           `xml:"STATUS>SEVERITY"`
+	Currency     string           `xml:"STMTRS>CURDEF"`
+	AccountID    string           `xml:"STMTRS>BANKACCTFROM>ACCTID"`
+	AccountType  string           `xml:"STMTRS>BANKACCTFROM>ACCTTYPE"`
+	Start        string           `xml:"STMTRS>BANKTRANLIST>DTSTART"`
+	End          string           `xml:"STMTRS>BANKTRANLIST>DTEND"`
+	Transactions []ofxTransaction `xml:"STMTRS>BANKTRANLIST>STMTTRN"`
+}
+
+type ofxDocument struct {
+	XMLName    xml.Name       `xml:"OFX"`
+	Status     int            `xml:"SIGNONMSGSRSV1>SONRS>STATUS>CODE"`
+	Severity   string         `xml:"SIGNONMSGSRSV1>SONRS>STATUS>SEVERITY"`
+	ServerTime string         `xml:"SIGNONMSGSRSV1>SONRS>DTSERVER"`
+	Language   string         `xml:"SIGNONMSGSRSV1>SONRS>LANGUAGE"`
+	Statements []ofxStatement `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+const ofxTime = "20060102150405"
+
+// WriteOFX writes an OFX 2 document with a statement per account and
+// commodity. OFX has no crypto currencies, so the currency is XXX and the
+// commodity is part of the account ID.
+func WriteOFX(w io.Writer, entries []Entry, now time.Time) error {
+	doc := ofxDocument{Severity: "INFO", ServerTime: now.UTC().Format(ofxTime), Language: "ENG"}
+	index := make(map[string]int)
+	for _, e := range entries {
+		id := e.Account + ":" + e.Commodity
+		if strings.HasSuffix(e.Account, ":"+e.Commodity) {
+			id = e.Account
+		}
+		i, ok := index[id]
+		if !ok {
+			i = len(doc.Statements)
+			index[id] = i
+			doc.Statements = append(doc.Statements, ofxStatement{TrnUID: strconv.Itoa(i + 1), Severity: "INFO", Currency: "XXX", AccountID: id, AccountType: "CHECKING"})
+		}
+		posted := e.Time.UTC().Format(ofxTime)
+		s := &doc.Statements[i]
+		if s.Start == "" || posted < s.Start {
+			s.Start = posted
+		}
+		if posted > s.End {
+			s.End = posted
+		}
+		name := e.Payee
+		if e.Kind == Deposit {
+			name = e.From
+		}
+		if len(name) > 32 { // the maximum length of NAME
+			name = name[:32]
+		}
+		s.Transactions = append(s.Transactions, ofxTransaction{
+			Type:   "CREDIT",
+			Posted: posted,
+			Amount: formatAmount(e.Amount),
+			ID:     e.ID,
+			Name:   name,
+			Memo:   e.description(),
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header+`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>`+"\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
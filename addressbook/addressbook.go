@@ -0,0 +1,184 @@
+// Package addressbook keeps every recharge address the server returned, so
+// that an old address can still be traced to its account after a rotation.
+package addressbook
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is an address of an account for a protocol and type.
+type Entry struct {
+	Server    string    `json:"server"`
+	Email     string    `json:"email"`
+	Profile   string    `json:"profile,omitempty"`
+	Protocol  int       `json:"protocol"`
+	Type      int       `json:"type"`
+	Address   string    `json:"address"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// Forced is set if the address was generated on request
+	Forced bool `json:"forced,omitempty"`
+}
+
+func (e Entry) samePair(o Entry) bool {
+	return e.Server == o.Server && e.Email == o.Email && e.Protocol == o.Protocol && e.Type == o.Type
+}
+
+// Book is an address book stored in a JSON file.
+type Book struct {
+	filename string
+	Entries  []Entry
+}
+
+// DefaultFile returns addresses.json in the user config dir.
+func DefaultFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ciac", "addresses.json"), nil
+}
+
+// Open reads the book from filename, a missing file is an empty book.
+func Open(filename string) (*Book, error) {
+	b := &Book{filename: filename}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &b.Entries); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Save writes the book, readable by the owner only. The file is replaced at
+// once, a crash while saving leaves the previous book.
+func (b *Book) Save() error {
+	data, err := json.MarshalIndent(b.Entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(b.filename)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(b.filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails once renamed
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), b.filename)
+}
+
+// Update opens the book in filename, lets update change it and saves it,
+// holding a lock on filename.lock so that the updates of several processes
+// do not overwrite each other. The book is not saved if update fails.
+func Update(filename string, update func(*Book) error) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(filename+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err = lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	b, err := Open(filename)
+	if err != nil {
+		return err
+	}
+	if err = update(b); err != nil {
+		return err
+	}
+	return b.Save()
+}
+
+// current returns the index of the most recently seen address of a pair, -1
+// if there is none.
+func (b *Book) current(e Entry) int {
+	found := -1
+	for i, o := range b.Entries {
+		if o.samePair(e) && (found < 0 || o.LastSeen.After(b.Entries[found].LastSeen)) {
+			found = i
+		}
+	}
+	return found
+}
+
+// Record adds an address returned by the server at now. If the pair had a
+// different address before, that one is returned as previous.
+func (b *Book) Record(e Entry, now time.Time) (previous *Entry) {
+	if i := b.current(e); i >= 0 && b.Entries[i].Address != e.Address {
+		p := b.Entries[i]
+		previous = &p
+	}
+	for i, o := range b.Entries {
+		if o.samePair(e) && o.Address == e.Address {
+			b.Entries[i].LastSeen = now
+			if e.Profile != "" {
+				b.Entries[i].Profile = e.Profile
+			}
+			return previous
+		}
+	}
+	e.FirstSeen, e.LastSeen = now, now
+	b.Entries = append(b.Entries, e)
+	return previous
+}
+
+// Filter returns the entries matching all non-empty arguments, ordered by
+// account, protocol, type and first seen time.
+func (b *Book) Filter(email, profile, address string) []Entry {
+	var list []Entry
+	for _, e := range b.Entries {
+		if email != "" && e.Email != email ||
+			profile != "" && e.Profile != profile ||
+			address != "" && !strings.EqualFold(e.Address, address) {
+			continue
+		}
+		list = append(list, e)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		switch {
+		case a.Server != b.Server:
+			return a.Server < b.Server
+		case a.Email != b.Email:
+			return a.Email < b.Email
+		case a.Protocol != b.Protocol:
+			return a.Protocol < b.Protocol
+		case a.Type != b.Type:
+			return a.Type < b.Type
+		}
+		return a.FirstSeen.Before(b.FirstSeen)
+	})
+	return list
+}
+
+// Current reports whether e is the latest address of its pair.
+func (b *Book) Current(e Entry) bool {
+	i := b.current(e)
+	return i >= 0 && b.Entries[i].Address == e.Address
+}
@@ -0,0 +1,80 @@
+package addressbook
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBook(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ciac", "addresses.json")
+	b, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	e := Entry{Server: "s", Email: "a@example.com", Protocol: 1, Type: 0, Address: "TXold"}
+	if p := b.Record(e, now); p != nil {
+		t.Errorf("first address has previous %+v", p)
+	}
+	if p := b.Record(e, now.Add(time.Hour)); p != nil {
+		t.Errorf("same address has previous %+v", p)
+	}
+	e.Address = "TXnew"
+	p := b.Record(e, now.Add(2*time.Hour))
+	if p == nil || p.Address != "TXold" {
+		t.Errorf("previous = %+v", p)
+	}
+	if err = b.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err = Open(filename); err != nil {
+		t.Fatal(err)
+	}
+	list := b.Filter("a@example.com", "", "")
+	if len(list) != 2 || list[0].Address != "TXold" || !list[0].LastSeen.Equal(now.Add(time.Hour)) {
+		t.Fatalf("entries = %+v", list)
+	}
+	if b.Current(list[0]) || !b.Current(list[1]) {
+		t.Error("TXnew is not the current address")
+	}
+	if owner := b.Filter("", "", "txold"); len(owner) != 1 || owner[0].Email != "a@example.com" {
+		t.Errorf("owner = %+v", owner)
+	}
+}
+
+// TestUpdate runs concurrent updates, none of them may be lost.
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "addresses.json")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := Update(filename, func(b *Book) error {
+				b.Record(Entry{Server: "s", Email: fmt.Sprintf("%d@example.com", i), Address: "TX"}, time.Now())
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	b, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Entries) != 8 {
+		t.Errorf("got %d entries, want 8", len(b.Entries))
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("files left: %v", files)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package addressbook
+
+import "os"
+
+// Without file locks only the updates of one process are serialized.
+
+func lockFile(*os.File) error { return nil }
+
+func unlockFile(*os.File) error { return nil }
@@ -0,0 +1,343 @@
+// Package batch runs scripts of ciac operations, each step for a profile, and
+// collects the results of all steps in one document.
+//
+// A script is YAML (or JSON):
+//
+//	vars:
+//	  since: 24h
+//	onError: continue
+//	steps:
+//	  - name: me
+//	    op: user
+//	    profile: alice
+//	  - op: recharged
+//	    profile: alice
+//	    params: {start: "${since}"}
+//	  - op: bind
+//	    profile: bob
+//	    params: {code: "${me.invitationCode}"}
+//
+// ${name} is replaced by a variable, ${step.field} by a field of the result
+// of an earlier named step, $$ by a single $.
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy tells what to do after a step failed.
+type Policy string
+
+const (
+	// Stop skips the remaining steps, the default.
+	Stop Policy = "stop"
+	// Continue runs the remaining steps.
+	Continue Policy = "continue"
+)
+
+// Params are the parameters of a step, after the substitution of variables.
+type Params map[string]string
+
+// String returns a parameter, def if it is not set.
+func (p Params) String(name, def string) string {
+	if v, ok := p[name]; ok {
+		return v
+	}
+	return def
+}
+
+// Bool returns a boolean parameter, false if it is not set.
+func (p Params) Bool(name string) (bool, error) {
+	v, ok := p[name]
+	if !ok || v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("bad %s %q: %w", name, v, err)
+	}
+	return b, nil
+}
+
+// Step is one operation of a script.
+type Step struct {
+	Name    string `yaml:"name"`
+	Op      string `yaml:"op"`
+	Profile string `yaml:"profile"`
+	Params  Params `yaml:"params"`
+	// OnError overrides the policy of the script for this step
+	OnError Policy `yaml:"onError"`
+}
+
+// Script is a list of steps with their variables.
+type Script struct {
+	Vars    map[string]string `yaml:"vars"`
+	OnError Policy            `yaml:"onError"`
+	Steps   []Step            `yaml:"steps"`
+}
+
+func checkPolicy(p Policy) error {
+	switch p {
+	case "", Stop, Continue:
+		return nil
+	}
+	return fmt.Errorf("unknown onError %q, valid are %s and %s", p, Stop, Continue)
+}
+
+// Parse reads a script, unknown fields are an error.
+func Parse(r io.Reader) (*Script, error) {
+	d := yaml.NewDecoder(r)
+	d.KnownFields(true)
+	var s Script
+	if err := d.Decode(&s); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty script")
+		}
+		return nil, err
+	}
+	if err := checkPolicy(s.OnError); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i, step := range s.Steps {
+		if step.Op == "" {
+			return nil, fmt.Errorf("step %d: op is missing", i+1)
+		}
+		if err := checkPolicy(step.OnError); err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if step.Name == "" {
+			continue
+		}
+		if strings.ContainsAny(step.Name, ".${}") {
+			return nil, fmt.Errorf("step %d: bad name %q", i+1, step.Name)
+		}
+		if names[step.Name] {
+			return nil, fmt.Errorf("step %d: duplicate name %q", i+1, step.Name)
+		}
+		if _, ok := s.Vars[step.Name]; ok {
+			return nil, fmt.Errorf("step %d: name %q is also a variable", i+1, step.Name)
+		}
+		names[step.Name] = true
+	}
+	return &s, nil
+}
+
+// Check reports steps whose op is not one of ops, before anything is run.
+func (s *Script) Check(ops map[string]Operation) error {
+	for i, step := range s.Steps {
+		if _, ok := ops[step.Op]; !ok {
+			return fmt.Errorf("step %d: unknown op %q", i+1, step.Op)
+		}
+	}
+	return nil
+}
+
+// Operation runs a step for a profile, "" is the default profile. The result
+// must encode to JSON.
+type Operation func(ctx context.Context, profile string, p Params) (interface{}, error)
+
+// Status of a step.
+const (
+	OK      = "ok"
+	Failed  = "failed"
+	Skipped = "skipped"
+)
+
+// StepResult is the outcome of a step.
+type StepResult struct {
+	Name     string      `json:"name,omitempty"`
+	Op       string      `json:"op"`
+	Profile  string      `json:"profile,omitempty"`
+	Params   Params      `json:"params,omitempty"`
+	Status   string      `json:"status"`
+	Error    string      `json:"error,omitempty"`
+	Duration float64     `json:"duration"` // seconds
+	Result   interface{} `json:"result,omitempty"`
+}
+
+// Result is the document of a run.
+type Result struct {
+	OK       bool              `json:"ok"`
+	Started  time.Time         `json:"started"`
+	Duration float64           `json:"duration"` // seconds
+	Vars     map[string]string `json:"vars,omitempty"`
+	Steps    []StepResult      `json:"steps"`
+}
+
+// Run runs the steps of a script in order with the operations by name. vars
+// override the variables of the script.
+func Run(ctx context.Context, s *Script, ops map[string]Operation, vars map[string]string) *Result {
+	started := time.Now()
+	res := &Result{OK: true, Started: started, Vars: make(map[string]string), Steps: []StepResult{}}
+	for k, v := range s.Vars {
+		res.Vars[k] = v
+	}
+	for k, v := range vars {
+		res.Vars[k] = v
+	}
+	// results of named steps, decoded from JSON for the lookup of fields
+	results := make(map[string]interface{})
+	lookup := func(ref string) (string, error) {
+		if v, ok := res.Vars[ref]; ok {
+			return v, nil
+		}
+		name := strings.SplitN(ref, ".", 2)[0]
+		r, ok := results[name]
+		if !ok {
+			return "", fmt.Errorf("unknown variable %q", ref)
+		}
+		return field(r, ref)
+	}
+
+	stop := false
+	for _, step := range s.Steps {
+		r := StepResult{Name: step.Name, Op: step.Op, Profile: step.Profile, Status: Skipped}
+		if stop {
+			res.Steps = append(res.Steps, r)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			r.Error = err.Error()
+			res.Steps = append(res.Steps, r)
+			res.OK, stop = false, true
+			continue
+		}
+
+		t := time.Now()
+		result, err := runStep(ctx, step, ops, lookup, &r)
+		r.Duration = time.Since(t).Seconds()
+		if err == nil {
+			err = remember(results, step.Name, result)
+		}
+		if err != nil {
+			r.Status, r.Error = Failed, err.Error()
+			res.OK = false
+			policy := step.OnError
+			if policy == "" {
+				policy = s.OnError
+			}
+			stop = policy != Continue
+		} else {
+			r.Status, r.Result = OK, result
+		}
+		res.Steps = append(res.Steps, r)
+	}
+	res.Duration = time.Since(started).Seconds()
+	return res
+}
+
+// runStep expands the profile and parameters of a step into r and runs it.
+func runStep(ctx context.Context, step Step, ops map[string]Operation, lookup func(string) (string, error), r *StepResult) (interface{}, error) {
+	op, ok := ops[step.Op]
+	if !ok {
+		return nil, fmt.Errorf("unknown op %q", step.Op)
+	}
+	profile, err := Expand(step.Profile, lookup)
+	if err != nil {
+		return nil, fmt.Errorf("profile: %w", err)
+	}
+	r.Profile = profile
+	if len(step.Params) > 0 {
+		r.Params = make(Params, len(step.Params))
+		for k, v := range step.Params {
+			if r.Params[k], err = Expand(v, lookup); err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	}
+	return op(ctx, profile, r.Params)
+}
+
+// remember keeps the result of a named step for ${name.field}.
+func remember(results map[string]interface{}, name string, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("encode result: %w", err)
+	}
+	if name == "" {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	results[name] = v
+	return nil
+}
+
+// field looks up a path like step.list.0.address in a decoded JSON value,
+// the first element being the step. Objects and lists are returned as JSON.
+func field(v interface{}, ref string) (string, error) {
+	parts := strings.Split(ref, ".")
+	for _, p := range parts[1:] {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = x[p]; !ok {
+				return "", fmt.Errorf("%s: no field %q", ref, p)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(x) {
+				return "", fmt.Errorf("%s: no element %q of %d", ref, p, len(x))
+			}
+			v = x[i]
+		default:
+			return "", fmt.Errorf("%s: %q of a scalar", ref, p)
+		}
+	}
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case nil:
+		return "", nil
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// Expand replaces ${ref} by lookup(ref) and $$ by $.
+func Expand(s string, lookup func(ref string) (string, error)) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			s = s[i+2:]
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			v, err := lookup(s[i+2 : i+end])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			s = s[i+end+1:]
+		default:
+			b.WriteByte('$')
+			s = s[i+1:]
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const script = `
+vars:
+  code: AB12cd
+steps:
+  - name: me
+    op: user
+    profile: alice
+  - op: bind
+    profile: bob
+    params: {code: "${me.invitationCode}", note: "$${code} is ${code}"}
+  - op: fail
+    onError: continue
+  - name: list
+    op: list
+  - op: bind
+    profile: "${me.email}"
+    params: {code: "${list.1.code}", n: "${list.0.n}", all: "${list}"}
+  - op: fail
+  - op: user
+`
+
+func ops(calls *[]string) map[string]Operation {
+	return map[string]Operation{
+		"user": func(ctx context.Context, profile string, p Params) (interface{}, error) {
+			*calls = append(*calls, "user "+profile)
+			return map[string]string{"email": profile + "@example.com", "invitationCode": "XY34ab"}, nil
+		},
+		"bind": func(ctx context.Context, profile string, p Params) (interface{}, error) {
+			*calls = append(*calls, "bind "+profile+" "+p.String("code", ""))
+			return p.String("note", p.String("n", "")), nil
+		},
+		"list": func(ctx context.Context, profile string, p Params) (interface{}, error) {
+			return []map[string]interface{}{{"n": 1e6}, {"code": "CD56ef"}}, nil
+		},
+		"fail": func(ctx context.Context, profile string, p Params) (interface{}, error) {
+			return nil, errors.New("boom")
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, err := Parse(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	if err := s.Check(ops(&calls)); err != nil {
+		t.Fatal(err)
+	}
+	res := Run(context.Background(), s, ops(&calls), map[string]string{"code": "ZZ99zz"})
+	if res.OK {
+		t.Error("ok with failed steps")
+	}
+	want := []string{"user alice", "bind bob XY34ab", "bind alice@example.com CD56ef"}
+	if strings.Join(calls, "|") != strings.Join(want, "|") {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	status := make([]string, len(res.Steps))
+	for i, r := range res.Steps {
+		status[i] = r.Status
+	}
+	if got := strings.Join(status, " "); got != "ok ok failed ok ok failed skipped" {
+		t.Errorf("status = %s", got)
+	}
+	if r := res.Steps[1]; r.Result != "${code} is ZZ99zz" {
+		t.Errorf("bind result = %v", r.Result)
+	}
+	if r := res.Steps[4]; r.Result != "1000000" || r.Params["all"] != `[{"n":1000000},{"code":"CD56ef"}]` {
+		t.Errorf("bind = %+v", r)
+	}
+	if r := res.Steps[2]; r.Error != "boom" {
+		t.Errorf("fail error = %q", r.Error)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	var calls []string
+	for _, tc := range []struct{ script, err string }{
+		{"steps: [{op: nope}]", `unknown op "nope"`},
+		{"steps: [{op: user, params: {x: '${y}'}}]", `x: unknown variable "y"`},
+		{"steps: [{op: user, name: me}, {op: user, params: {x: '${me.code}'}}]", `x: me.code: no field "code"`},
+		{"steps: [{op: user, params: {x: '${y'}}]", "unterminated"},
+	} {
+		s, err := Parse(strings.NewReader(tc.script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Check(ops(&calls)); (err != nil) != strings.HasPrefix(tc.err, "unknown op") {
+			t.Errorf("%s: check error = %v", tc.script, err)
+		}
+		res := Run(context.Background(), s, ops(&calls), nil)
+		last := res.Steps[len(res.Steps)-1]
+		if res.OK || !strings.Contains(last.Error, tc.err) {
+			t.Errorf("%s: error = %q, want %q", tc.script, last.Error, tc.err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct{ script, err string }{
+		{"", "empty script"},
+		{"steps: [{profile: alice}]", "op is missing"},
+		{"onError: retry", "unknown onError"},
+		{"steps: [{op: user, onError: never}]", "unknown onError"},
+		{"steps: [{op: user, name: a}, {op: user, name: a}]", "duplicate name"},
+		{"vars: {a: x}\nsteps: [{op: user, name: a}]", "also a variable"},
+		{"steps: [{op: user, name: a.b}]", "bad name"},
+		{"steps: [{op: user, parms: {}}]", "field parms not found"},
+	} {
+		_, err := Parse(strings.NewReader(tc.script))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: error = %v, want %q", tc.script, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Pair is a protocol and a type id of the recharge API. The API documents no
+// names for the ids, so they are only shown as numbers.
+type Pair struct {
+	Protocol int `json:"protocol"`
+	Type     int `json:"type"`
+}
+
+// ValidPairs are the pairs the server has addresses for, sorted.
+var ValidPairs = []Pair{
+	{0, 0}, {0, 1}, {0, 2}, {0, 3},
+	{1, 0}, {1, 1},
+	{2, 0},
+}
+
+// Valid reports whether the server has addresses for the pair.
+func (p Pair) Valid() bool {
+	for _, v := range ValidPairs {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Protocols returns the protocol ids of ValidPairs, sorted.
+func Protocols() []int {
+	return ids(func(p Pair) int { return p.Protocol })
+}
+
+// Types returns the type ids of ValidPairs, sorted.
+func Types() []int {
+	return ids(func(p Pair) int { return p.Type })
+}
+
+func ids(id func(Pair) int) []int {
+	seen := make(map[int]bool)
+	var list []int
+	for _, p := range ValidPairs {
+		if !seen[id(p)] {
+			seen[id(p)] = true
+			list = append(list, id(p))
+		}
+	}
+	sort.Ints(list)
+	return list
+}
+
+// String returns the ids of the pair, e.g. 1/0.
+func (p Pair) String() string {
+	return fmt.Sprintf("%d/%d", p.Protocol, p.Type)
+}
+
+// SortPairs orders pairs by protocol, then type.
+func SortPairs(pairs []Pair) {
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Protocol != pairs[j].Protocol {
+			return pairs[i].Protocol < pairs[j].Protocol
+		}
+		return pairs[i].Type < pairs[j].Type
+	})
+}
+
+// AddressEntry is the recharge address of a pair.
+type AddressEntry struct {
+	Pair
+	Address string `json:"address"`
+	// Remarks is the note the server sends along, e.g. the network to use
+	Remarks string `json:"remarks,omitempty"`
+}
+
+func newEntry(p Pair) AddressEntry {
+	return AddressEntry{Pair: p}
+}
+
+func (c *Client) Address(ctx context.Context, protocol, cType int, force bool) (AddressEntry, error) {
+	entry := newEntry(Pair{protocol, cType})
+	_, err := c.Login(ctx, false)
+	if err != nil {
+		return entry, err
+	}
+
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return entry, err
+	}
+	u.Path = path.Join(u.Path, "recharge")
+	q := u.Query()
+	q.Set("protocol", strconv.Itoa(protocol))
+	q.Set("type", strconv.Itoa(cType))
+	q.Set("force", fmt.Sprintf("%v", force))
+	q.Set("tamptime", strconv.FormatInt(time.Now().Unix()*1000, 10))
+	u.RawQuery = q.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return entry, err
+	}
+	c.authorize(request)
+	hc := newHTTPClient()
+	resp, err := hc.Do(request)
+	if err != nil {
+		return entry, err
+	}
+	defer resp.Body.Close()
+	log.Printf("Status: %s", resp.Status)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return entry, err
+	}
+	log.Printf("Raw response: %s", string(body))
+	var ret addressResponse
+	if err := decode(http.MethodGet, "/recharge", body, &ret, c.strict); err != nil {
+		return entry, err
+	}
+	if ret.State == 200 {
+		entry.Address = ret.Data.Address
+		entry.Remarks = ret.Data.Remarks
+	}
+	return entry, nil
+}
+
+// AddressResult is the address of a pair, or the error getting it.
+type AddressResult struct {
+	AddressEntry
+	Err error `json:"-"`
+}
+
+// Addresses gets the addresses of pairs, up to the client's concurrency at a
+// time. The results are sorted by protocol, then type.
+func (c *Client) Addresses(ctx context.Context, pairs []Pair, force bool) []AddressResult {
+	pairs = append([]Pair(nil), pairs...)
+	SortPairs(pairs)
+	results := make([]AddressResult, len(pairs))
+	// login first, so that the requests below share the token
+	if _, err := c.Login(ctx, false); err != nil {
+		for i, p := range pairs {
+			results[i] = AddressResult{AddressEntry: newEntry(p), Err: err}
+		}
+		return results
+	}
+	errs := ForEach(ctx, c.concurrency, len(pairs), func(ctx context.Context, i int) (err error) {
+		results[i].AddressEntry, err = c.Address(ctx, pairs[i].Protocol, pairs[i].Type, force)
+		return err
+	})
+	for i, err := range errs {
+		results[i].Err = err
+	}
+	return results
+}
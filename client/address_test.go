@@ -0,0 +1,29 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortPairs(t *testing.T) {
+	pairs := []Pair{{2, 0}, {0, 3}, {1, 1}, {0, 0}, {1, 0}}
+	SortPairs(pairs)
+	want := []Pair{{0, 0}, {0, 3}, {1, 0}, {1, 1}, {2, 0}}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Errorf("sorted = %v, want %v", pairs, want)
+	}
+	for _, p := range ValidPairs {
+		if !p.Valid() {
+			t.Errorf("%s not valid", p)
+		}
+	}
+	if p := (Pair{2, 1}); p.Valid() || p.String() != "2/1" {
+		t.Errorf("%s valid = %v", p, p.Valid())
+	}
+	if got := Protocols(); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("protocols = %v", got)
+	}
+	if got := Types(); !reflect.DeepEqual(got, []int{0, 1, 2, 3}) {
+		t.Errorf("types = %v", got)
+	}
+}
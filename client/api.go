@@ -0,0 +1,108 @@
+package client
+
+// Wire types of the caitan API, described in openapi.json. Every response is
+// an envelope of the HTTP-like state, a message and the data, where a result
+// of 1 means success. TestSpec fails when these types drift from the spec.
+
+// RespTimestamp is the response of /timestamp.
+type RespTimestamp struct {
+	State   int    `json:"state"`
+	Message string `json:"msg"`
+	Data    struct {
+		Result    int   `json:"result"`
+		Timestamp int64 `json:"timestamp"`
+	} `json:"data"`
+}
+
+type loginRequest struct {
+	Email     string `json:"mail"`
+	Password  string `json:"pwd"`
+	Timestamp string `json:"tamptime"`
+}
+
+type sendCodeRequest struct {
+	Email     string `json:"mail"`
+	Timestamp string `json:"tamptime"`
+}
+
+type registerRequest struct {
+	Email      string `json:"mail"`
+	Password   string `json:"pwd"`
+	VerifyCode string `json:"code,omitempty"`
+	InviteCode string `json:"invitationCode,omitempty"`
+	Timestamp  string `json:"tamptime"`
+}
+
+type resetPasswordRequest struct {
+	Email      string `json:"mail"`
+	Password   string `json:"pwd"`
+	VerifyCode string `json:"code"`
+	Timestamp  string `json:"tamptime"`
+}
+
+type changePasswordRequest struct {
+	Password    string `json:"pwd"`
+	NewPassword string `json:"newPwd"`
+	Timestamp   string `json:"tamptime"`
+}
+
+// resultResponse is the response of the endpoints returning a result only.
+type resultResponse struct {
+	State   int    `json:"state"`
+	Message string `json:"msg"`
+	Data    struct {
+		Result int `json:"result"`
+	} `json:"data"`
+}
+
+type loginResponse struct {
+	State   int    `json:"state"`
+	Message string `json:"msg"`
+	Data    struct {
+		Result int `json:"result"`
+		IV     int `json:"IV"`
+	} `json:"data"`
+}
+
+type userResponse struct {
+	State   int    `json:"state"`
+	Message string `json:"msg"`
+	Data    struct {
+		Result     int    `json:"result"`
+		NickName   string `json:"nickName"`
+		Email      string `json:"email"`
+		Code       string `json:"code"`
+		Expire     string `json:"expire"`
+		RemainTime int64  `json:"remainingTime"` // ms
+	} `json:"data"`
+}
+
+type invitationRecordResponse struct {
+	State   int    `json:"state"`
+	Message string `json:"msg"`
+	Data    struct {
+		Result  int                `json:"result"`
+		Records []InvitationRecord `json:"record"`
+	} `json:"data"`
+}
+
+type rechargeRecordResponse struct {
+	State   int    `json:"state"`
+	Message string `json:"msg"`
+	Data    struct {
+		Result  int              `json:"result"`
+		Records []RechargeRecord `json:"record"`
+	} `json:"data"`
+}
+
+type addressResponse struct {
+	State   int    `json:"state"`
+	Message string `json:"msg"`
+	Data    struct {
+		Result   int    `json:"result"`
+		Protocol int    `json:"protocol"`
+		Type     int    `json:"type"`
+		Address  string `json:"addressText"`
+		Remarks  string `json:"remarks"`
+	} `json:"data"`
+}
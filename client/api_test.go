@@ -0,0 +1,191 @@
+package client
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/caitan-app/ciac/client/cassette"
+)
+
+func (s *spec) params(op operation) map[string]bool {
+	names := make(map[string]bool)
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			p = s.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+		}
+		names[p.Name] = true
+	}
+	return names
+}
+
+// jsonName returns the JSON name of a field and whether it is omitted when empty.
+func jsonName(f reflect.StructField) (name string, omitEmpty bool) {
+	tag, ok := f.Tag.Lookup("json")
+	if !ok {
+		return f.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		omitEmpty = omitEmpty || opt == "omitempty"
+	}
+	return parts[0], omitEmpty
+}
+
+var kinds = map[reflect.Kind]string{
+	reflect.String:  "string",
+	reflect.Int:     "integer",
+	reflect.Int64:   "integer",
+	reflect.Float64: "number",
+	reflect.Bool:    "boolean",
+	reflect.Slice:   "array",
+	reflect.Struct:  "object",
+}
+
+// drift compares a Go type with its schema, request types must also agree on
+// which fields are required.
+func (s *spec) drift(t *testing.T, where string, typ reflect.Type, sc *schema, request bool) {
+	sc = s.resolve(sc)
+	if sc == nil {
+		t.Errorf("%s: no schema", where)
+		return
+	}
+	if kinds[typ.Kind()] != sc.Type {
+		t.Errorf("%s: %s in Go, %s in spec", where, typ.Kind(), sc.Type)
+		return
+	}
+	switch typ.Kind() {
+	case reflect.Slice:
+		s.drift(t, where+"[]", typ.Elem(), sc.Items, request)
+	case reflect.Struct:
+		fields := make(map[string]bool)
+		required := make(map[string]bool)
+		for _, name := range sc.Required {
+			required[name] = true
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			name, omitEmpty := jsonName(f)
+			fields[name] = true
+			p, ok := sc.Properties[name]
+			if !ok {
+				t.Errorf("%s.%s: not in spec", where, name)
+				continue
+			}
+			if omitEmpty && required[name] {
+				t.Errorf("%s.%s: required in spec but omitempty", where, name)
+			}
+			if request && !omitEmpty && !required[name] {
+				t.Errorf("%s.%s: always sent but optional in spec", where, name)
+			}
+			s.drift(t, where+"."+name, f.Type, p, request)
+		}
+		for name := range sc.Properties {
+			if !fields[name] {
+				t.Errorf("%s.%s: in spec but not in Go", where, name)
+			}
+		}
+	}
+}
+
+func TestSpec(t *testing.T) {
+	s := loadSpec()
+	tests := []struct {
+		method, path      string
+		request, response interface{}
+	}{
+		{"get", "/timestamp", nil, RespTimestamp{}},
+		{"post", "/sendCode", sendCodeRequest{}, resultResponse{}},
+		{"post", "/register", registerRequest{}, resultResponse{}},
+		{"post", "/resetPassword", resetPasswordRequest{}, resultResponse{}},
+		{"post", "/login", loginRequest{}, loginResponse{}},
+		{"post", "/changePassword", changePasswordRequest{}, resultResponse{}},
+		{"get", "/user", nil, userResponse{}},
+		{"get", "/invitationRecord", nil, invitationRecordResponse{}},
+		{"get", "/rechargeRecord", nil, rechargeRecordResponse{}},
+		{"get", "/bindInvitation", nil, resultResponse{}},
+		{"get", "/recharge", nil, addressResponse{}},
+	}
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		where := tt.method + " " + tt.path
+		covered[where] = true
+		op, ok := s.Paths[tt.path][tt.method]
+		if !ok {
+			t.Errorf("%s: not in spec", where)
+			continue
+		}
+		if tt.request != nil {
+			s.drift(t, where+" request", reflect.TypeOf(tt.request), schemaOf(op.RequestBody), true)
+		} else if op.RequestBody != nil {
+			t.Errorf("%s: spec has a request body", where)
+		}
+		resp := op.Responses["200"]
+		s.drift(t, where+" response", reflect.TypeOf(tt.response), schemaOf(&resp), false)
+	}
+	for path, ops := range s.Paths {
+		for method := range ops {
+			if !covered[method+" "+path] {
+				t.Errorf("%s %s: in spec but not used by the client", method, path)
+			}
+		}
+	}
+}
+
+// TestSpecSession checks the recorded requests against the spec, so that a
+// query parameter or body field the client sends is always declared.
+func TestSpecSession(t *testing.T) {
+	s := loadSpec()
+	files, err := filepath.Glob(filepath.Join("testdata", "session", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range files {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var i cassette.Interaction
+		if err = json.Unmarshal(b, &i); err != nil {
+			t.Fatalf("%s: %s", filename, err)
+		}
+		op, ok := s.Paths[i.Request.Path][strings.ToLower(i.Request.Method)]
+		if !ok {
+			t.Errorf("%s: %s %s not in spec", filename, i.Request.Method, i.Request.Path)
+			continue
+		}
+		query, err := url.ParseQuery(i.Request.Query)
+		if err != nil {
+			t.Fatalf("%s: %s", filename, err)
+		}
+		params := s.params(op)
+		for name := range query {
+			if !params[name] {
+				t.Errorf("%s: query parameter %s not in spec", filename, name)
+			}
+		}
+		if i.Request.Body == "" {
+			continue
+		}
+		var body map[string]interface{}
+		if err = json.Unmarshal([]byte(i.Request.Body), &body); err != nil {
+			t.Fatalf("%s: %s", filename, err)
+		}
+		sc := s.resolve(schemaOf(op.RequestBody))
+		var unknown []string
+		for name := range body {
+			if sc == nil || sc.Properties[name] == nil {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		if len(unknown) > 0 {
+			t.Errorf("%s: body fields %v not in spec", filename, unknown)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package cassette records HTTP interactions into fixture files and replays
+// them offline, so client tests and bug reports do not need the live server.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// volatileParam is the timestamp every request carries, it is ignored when matching.
+const volatileParam = "tamptime"
+
+// Interaction is one recorded request/response pair, stored as one JSON file.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status     string      `json:"status"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+const redacted = "REDACTED"
+
+var (
+	jwtPattern      = regexp.MustCompile(`eyJ[\w-]*\.[\w-]*\.[\w-]*`)
+	jwtCookie       = regexp.MustCompile(`jwt=[^;\s"]+`)
+	emailPattern    = regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)
+	escapedEmail    = regexp.MustCompile(`[\w.+-]+%40[\w-]+(\.[\w-]+)+`)
+	passwordPattern = regexp.MustCompile(`"(pwd|newPwd|password)"\s*:\s*"[^"]*"`)
+)
+
+// Scrub removes JWTs, emails and passwords from s.
+func Scrub(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = jwtCookie.ReplaceAllString(s, "jwt="+redacted)
+	s = emailPattern.ReplaceAllString(s, "user@example.com")
+	s = escapedEmail.ReplaceAllString(s, "user%40example.com")
+	s = passwordPattern.ReplaceAllString(s, `"$1":"`+redacted+`"`)
+	return s
+}
+
+// normalizeQuery drops the volatile parameter and sorts the rest.
+func normalizeQuery(raw string) string {
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	q.Del(volatileParam)
+	return q.Encode()
+}
+
+// normalizeBody drops the volatile field from JSON bodies.
+func normalizeBody(body string) string {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &m); err != nil {
+		return body
+	}
+	delete(m, volatileParam)
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// newRequest captures the scrubbed and normalized form of r, used both when
+// recording and when looking up a recorded interaction.
+func newRequest(r *http.Request) (Request, error) {
+	req := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  Scrub(normalizeQuery(r.URL.RawQuery)),
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return req, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.Body = Scrub(normalizeBody(string(body)))
+	}
+	return req, nil
+}
+
+func (r Request) matches(o Request) bool {
+	return r.Method == o.Method && r.Path == o.Path && r.Query == o.Query && r.Body == o.Body
+}
+
+// Recorder sends requests with the next transport and saves every
+// interaction into dir.
+type Recorder struct {
+	dir  string
+	next http.RoundTripper
+
+	mu sync.Mutex
+	n  int
+}
+
+// NewRecorder creates dir if needed, new recordings are numbered after the
+// files already in it. A nil next means http.DefaultTransport.
+func NewRecorder(dir string, next http.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{dir: dir, next: next, n: len(files)}, nil
+}
+
+func (rec *Recorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	req, err := newRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := rec.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	for k, vs := range header {
+		for i, v := range vs {
+			header[k][i] = Scrub(v)
+		}
+	}
+	it := Interaction{
+		Request: req,
+		Response: Response{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       Scrub(string(body)),
+		},
+	}
+	if err = rec.save(it); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (rec *Recorder) save(it Interaction) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.n++
+	name := strings.Trim(strings.ReplaceAll(it.Request.Path, "/", "-"), "-")
+	if name == "" {
+		name = "root"
+	}
+	data, err := json.MarshalIndent(it, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(rec.dir, fmt.Sprintf("%04d-%s.json", rec.n, name))
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// ErrNoInteraction is returned by Replayer when nothing recorded matches the request.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction matches the request")
+
+// Replayer answers requests from the interactions recorded in a directory,
+// no network access is done.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewReplayer loads every interaction in dir, in file name order.
+func NewReplayer(dir string) (*Replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("cassette: no interactions in %s", dir)
+	}
+	sort.Strings(files)
+	r := &Replayer{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var it Interaction
+		if err = json.Unmarshal(data, &it); err != nil {
+			return nil, fmt.Errorf("cassette: parse %s: %w", f, err)
+		}
+		r.interactions = append(r.interactions, it)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// RoundTrip returns the first unused matching interaction, once all matching
+// ones are used the last of them is repeated.
+func (rp *Replayer) RoundTrip(r *http.Request) (*http.Response, error) {
+	req, err := newRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	found := -1
+	for i, it := range rp.interactions {
+		if !it.Request.matches(req) {
+			continue
+		}
+		found = i
+		if !rp.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, fmt.Errorf("%w: %s %s?%s", ErrNoInteraction, req.Method, path.Clean(req.Path), req.Query)
+	}
+	rp.used[found] = true
+	it := rp.interactions[found]
+	return &http.Response{
+		Status:        it.Response.Status,
+		StatusCode:    it.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        it.Response.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(it.Response.Body)),
+		ContentLength: int64(len(it.Response.Body)),
+		Request:       r,
+	}, nil
+}
@@ -0,0 +1,98 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "jwt", Value: "eyJhbGciOiJIUzI1NiJ9.eyJpZCI6ImEifQ.sig", MaxAge: 3600})
+			_, _ = w.Write([]byte(`{"state":200,"data":{"result":1}}`))
+		case "/user":
+			_, _ = w.Write([]byte(`{"state":200,"data":{"email":"someone@caitan.app","code":"AB12"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	dir := t.TempDir()
+
+	recorder, err := NewRecorder(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := &http.Client{Transport: recorder}
+	resp, err := hc.Post(server.URL+"/login", "application/json",
+		strings.NewReader(`{"mail":"someone@caitan.app","pwd":"secret","tamptime":"1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	resp, err = hc.Get(server.URL + "/user?tamptime=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	server.Close()
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("recorded %d files, want 2", len(files))
+	}
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(dir + "/" + f.Name())
+		for _, secret := range []string{"secret", "someone@caitan.app", "eyJ"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains %q", f.Name(), secret)
+			}
+		}
+	}
+
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc = &http.Client{Transport: replayer}
+	resp, err = hc.Post("http://offline/login", "application/json",
+		strings.NewReader(`{"mail":"other@caitan.app","pwd":"other","tamptime":"2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if cookie := resp.Header.Get("Set-Cookie"); !strings.HasPrefix(cookie, "jwt="+redacted) {
+		t.Errorf("Set-Cookie = %q", cookie)
+	}
+	resp, err = hc.Get("http://offline/user?tamptime=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"code":"AB12"`) {
+		t.Errorf("unexpected body %s", body)
+	}
+	if _, err = hc.Get("http://offline/recharge"); err == nil {
+		t.Error("expected an error for an unrecorded request")
+	}
+}
+
+func TestScrub(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"mail":"a.b+c@gmail.com","pwd":"x"}`, `{"mail":"user@example.com","pwd":"REDACTED"}`},
+		{"jwt=abc.def; Path=/", "jwt=REDACTED; Path=/"},
+		{"Bearer eyJa.eyJb.c", "Bearer REDACTED"},
+		{"mail=a%40b.com&x=1", "mail=user%40example.com&x=1"},
+	}
+	for i, tt := range tests {
+		if got := Scrub(tt.in); got != tt.want {
+			t.Errorf("[%d] Scrub(%q) = %q, want %q", i, tt.in, got, tt.want)
+		}
+	}
+}
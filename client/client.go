@@ -1,8 +1,10 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,50 +12,108 @@ import (
 	"net/url"
 	"path"
 	"strconv"
+	"sync"
 	"time"
 )
 
 type Config struct {
-	Email     string
-	Password  string
+	Email     string `json:"email"`
+	Password  string `json:"password"`
 	TokenFile string `json:"tokenFile"`
+	// SendCookie sends the session cookies along with the Authorization header
+	SendCookie bool `json:"sendCookie,omitempty"`
 }
 
 type Client struct {
 	cfg    Config
 	Server string
 
-	token *Token
+	// mu guards token and cfg.Password, so that concurrent requests login
+	// only once and with the current password
+	mu     sync.Mutex
+	token  *Token
+	strict bool
+	// concurrency bounds the requests of fan-out operations
+	concurrency int
 }
 
 type Token struct {
 	JWT      string    `json:"jwt"`
 	ExpireAt time.Time `json:"expireAt"`
+	// Cookies are all cookies set by login, with Max-Age converted to Expires
+	Cookies []*http.Cookie `json:"cookies,omitempty"`
 }
 
-func New(cfg Config, server string) *Client {
-	return &Client{cfg: cfg, Server: server}
+// Option configures a Client.
+type Option func(*Client)
+
+// WithStrictDecoding rejects responses which do not match the API spec with a
+// *SchemaError naming the diverging fields. Otherwise such responses are
+// decoded anyway and a warning is logged once per endpoint and field.
+func WithStrictDecoding(strict bool) Option {
+	return func(c *Client) {
+		c.strict = strict
+	}
+}
+
+// WithConcurrency lets fan-out operations like Addresses and the All*Records
+// methods run up to n requests at a time, the default is 1. Values below 1
+// are taken as 1.
+func WithConcurrency(n int) Option {
+	return func(c *Client) {
+		if n < 1 {
+			n = 1
+		}
+		c.concurrency = n
+	}
 }
 
-func (c Client) Email() string {
+func New(cfg Config, server string, opts ...Option) *Client {
+	c := &Client{cfg: cfg, Server: server, concurrency: 1}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) Email() string {
 	return c.cfg.Email
 }
 
-func (c *Client) Login(force bool) (*Token, error) {
+// Config returns the config the client is currently using, the password is
+// updated after a successful ChangePassword.
+func (c *Client) Config() Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cfg
+}
+
+// Logout drops the cached token, the next request will login again.
+func (c *Client) Logout() error {
+	return c.removeToken()
+}
+
+func (c *Client) Login(ctx context.Context, force bool) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if force {
-		return c.loginAndSave()
+		return c.loginAndSave(ctx)
+	}
+	// reuse the token in memory, no need to read the file again
+	if c.token != nil && c.token.ExpireAt.After(time.Now()) {
+		return c.token, nil
 	}
 
 	if token, err := c.loadToken(); err != nil {
 		return nil, err
 	} else if token == nil {
 		// first time run, login to get a token
-		return c.loginAndSave()
+		return c.loginAndSave(ctx)
 	} else {
 		// get a old cached token, check if it is expired
 		if !token.ExpireAt.After(time.Now()) { // expired
 			log.Printf("cookie expired at %s, need refresh", token.ExpireAt)
-			return c.loginAndSave()
+			return c.loginAndSave(ctx)
 		}
 		c.token = token
 		return token, nil
@@ -61,14 +121,66 @@ func (c *Client) Login(force bool) (*Token, error) {
 }
 
 type Profile struct {
-	Email         string `json:"email"`
-	Code          string `json:"invitationCode"`
-	Expire        string `json:"expire"`
+	Email         string        `json:"email"`
+	Code          string        `json:"invitationCode"`
+	Expire        string        `json:"expire"`
+	ExpireAt      time.Time     `json:"expireAt"`
+	RemainingTime time.Duration `json:"remainingTime"`
+}
+
+// profileJSON keeps remainingTime a duration string like "24h0m0s" in JSON,
+// as it was before it became a time.Duration.
+type profileJSON struct {
+	profile
 	RemainingTime string `json:"remainingTime"`
 }
 
+type profile Profile
+
+func (p Profile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(profileJSON{profile(p), p.RemainingTime.String()})
+}
+
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	var v profileJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = Profile(v.profile)
+	if v.RemainingTime != "" {
+		d, err := time.ParseDuration(v.RemainingTime)
+		if err != nil {
+			return fmt.Errorf("bad remainingTime %q: %w", v.RemainingTime, err)
+		}
+		p.RemainingTime = d
+	}
+	return nil
+}
+
+// expireLayouts are the formats the server has used for Profile.Expire.
+var expireLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseExpire parses the expire field of the user info, when it is empty or
+// in an unknown format the expiry is derived from the remaining time.
+func parseExpire(expire string, remaining time.Duration, now time.Time) time.Time {
+	for _, layout := range expireLayouts {
+		if t, err := time.ParseInLocation(layout, expire, time.Local); err == nil {
+			return t
+		}
+	}
+	if ms, err := strconv.ParseInt(expire, 10, 64); err == nil && ms > 0 {
+		return time.Unix(ms/1000, ms%1000*1e6)
+	}
+	return now.Add(remaining)
+}
+
 func (c *Client) UserInfo(ctx context.Context) (*Profile, error) {
-	if _, err := c.Login(false); err != nil {
+	if _, err := c.Login(ctx, false); err != nil {
 		return nil, err
 	}
 
@@ -86,8 +198,8 @@ func (c *Client) UserInfo(ctx context.Context) (*Profile, error) {
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.token.JWT))
-	hc := &http.Client{}
+	c.authorize(request)
+	hc := newHTTPClient()
 	resp, err := hc.Do(request)
 	if err != nil {
 		return nil, err
@@ -100,28 +212,19 @@ func (c *Client) UserInfo(ctx context.Context) (*Profile, error) {
 	}
 	log.Printf("Raw response: %s", string(body))
 
-	var ret struct {
-		State   int
-		Message string `json:"msg"`
-		Data    struct {
-			Result     int
-			NickName   string `json:"nickName"`
-			Email      string
-			Code       string
-			Expire     string
-			RemainTime int64 `json:"remainingTime"`
-		}
-	}
-	if err = json.Unmarshal(body, &ret); err != nil {
+	var ret userResponse
+	if err = decode(http.MethodGet, "/user", body, &ret, c.strict); err != nil {
 		return nil, err
 	}
 	log.Printf("Response:\n%s", BeautifyJson(ret))
 
+	remaining := time.Duration(ret.Data.RemainTime) * time.Millisecond
 	profile := Profile{
 		Email:         ret.Data.Email,
 		Code:          ret.Data.Code,
 		Expire:        ret.Data.Expire,
-		RemainingTime: time.Duration(ret.Data.RemainTime * 1e6).String(),
+		ExpireAt:      parseExpire(ret.Data.Expire, remaining, time.Now()),
+		RemainingTime: remaining,
 	}
 	log.Printf("Profile:\n%s", BeautifyJson(profile))
 	return &profile, nil
@@ -136,7 +239,7 @@ type InvitationRecord struct {
 }
 
 func (c *Client) InvitationRecords(ctx context.Context, start, end int64, page, pageSize int) ([]InvitationRecord, error) {
-	if _, err := c.Login(false); err != nil {
+	if _, err := c.Login(ctx, false); err != nil {
 		return nil, err
 	}
 
@@ -144,20 +247,13 @@ func (c *Client) InvitationRecords(ctx context.Context, start, end int64, page,
 	if err != nil {
 		return nil, err
 	}
-	data, err := getRecords(ctx, url, c.token.JWT)
+	data, err := c.getRecords(ctx, url)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp struct {
-		State   int
-		Message string `json:"msg"`
-		Data    struct {
-			Result  int
-			Records []InvitationRecord `json:"record"`
-		}
-	}
-	if err = json.Unmarshal(data, &resp); err != nil {
+	var resp invitationRecordResponse
+	if err = decode(http.MethodGet, "/invitationRecord", data, &resp, c.strict); err != nil {
 		return nil, err
 	}
 	//log.Printf("Response:\n%s", BeautifyJson(resp))
@@ -165,6 +261,53 @@ func (c *Client) InvitationRecords(ctx context.Context, start, end int64, page,
 	return resp.Data.Records, nil
 }
 
+// allPageSize is the page size used when walking through all pages.
+const allPageSize = 100
+
+// allPages fetches pages in batches of c.concurrency until a page is empty,
+// fetch stores page i and returns its length. A short page does not end the
+// walk, the server may cap the page size below allPageSize.
+func (c *Client) allPages(ctx context.Context, fetch func(ctx context.Context, page int) (int, error)) error {
+	for first := 0; ; first += c.concurrency {
+		lengths := make([]int, c.concurrency)
+		errs := ForEach(ctx, c.concurrency, c.concurrency, func(ctx context.Context, i int) (err error) {
+			lengths[i], err = fetch(ctx, first+i)
+			return err
+		})
+		if err := FirstError(errs); err != nil {
+			return err
+		}
+		for _, n := range lengths {
+			if n == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// AllInvitationRecords fetches every page of invitation records between start and end.
+func (c *Client) AllInvitationRecords(ctx context.Context, start, end int64) ([]InvitationRecord, error) {
+	var (
+		mu    sync.Mutex
+		pages = make(map[int][]InvitationRecord)
+	)
+	err := c.allPages(ctx, func(ctx context.Context, page int) (int, error) {
+		records, err := c.InvitationRecords(ctx, start, end, page, allPageSize)
+		mu.Lock()
+		pages[page] = records
+		mu.Unlock()
+		return len(records), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var all []InvitationRecord
+	for page := 0; len(pages[page]) > 0; page++ {
+		all = append(all, pages[page]...)
+	}
+	return all, nil
+}
+
 type RechargeRecord struct {
 	RechargeFor    int     `json:"rechargeFor"`
 	RechargeFrom   string  `json:"rechargeFrom"`
@@ -179,7 +322,7 @@ type RechargeRecord struct {
 }
 
 func (c *Client) RechargeRecords(ctx context.Context, start, end int64, page, pageSize int) ([]RechargeRecord, error) {
-	_, err := c.Login(false)
+	_, err := c.Login(ctx, false)
 	if err != nil {
 		return nil, err
 	}
@@ -187,20 +330,13 @@ func (c *Client) RechargeRecords(ctx context.Context, start, end int64, page, pa
 	if err != nil {
 		return nil, err
 	}
-	data, err := getRecords(ctx, url, c.token.JWT)
+	data, err := c.getRecords(ctx, url)
 	if err != nil {
 		return nil, err
 	}
 
-	var resp struct {
-		State   int
-		Message string `json:"msg"`
-		Data    struct {
-			Result  int
-			Records []RechargeRecord `json:"record"`
-		}
-	}
-	if err = json.Unmarshal(data, &resp); err != nil {
+	var resp rechargeRecordResponse
+	if err = decode(http.MethodGet, "/rechargeRecord", data, &resp, c.strict); err != nil {
 		return nil, err
 	}
 	//log.Printf("Response:\n%s", BeautifyJson(resp))
@@ -208,15 +344,55 @@ func (c *Client) RechargeRecords(ctx context.Context, start, end int64, page, pa
 	return resp.Data.Records, nil
 }
 
-func (c *Client) Bind(ctx context.Context, code string) (bool, error) {
-	_, err := c.Login(false)
+// AllRechargeRecords fetches every page of recharge records between start and end.
+func (c *Client) AllRechargeRecords(ctx context.Context, start, end int64) ([]RechargeRecord, error) {
+	var (
+		mu    sync.Mutex
+		pages = make(map[int][]RechargeRecord)
+	)
+	err := c.allPages(ctx, func(ctx context.Context, page int) (int, error) {
+		records, err := c.RechargeRecords(ctx, start, end, page, allPageSize)
+		mu.Lock()
+		pages[page] = records
+		mu.Unlock()
+		return len(records), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var all []RechargeRecord
+	for page := 0; len(pages[page]) > 0; page++ {
+		all = append(all, pages[page]...)
+	}
+	return all, nil
+}
+
+// BindResult is the outcome of binding an invitation code. Only result 1 is
+// known to mean success, anything else is reported with the server message.
+type BindResult struct {
+	Bound   bool   `json:"bound"`
+	Result  int    `json:"result"`
+	Message string `json:"message,omitempty"`
+}
+
+func (r BindResult) String() string {
+	if r.Bound {
+		return "bound"
+	}
+	return fmt.Sprintf("failed (result %d: %s)", r.Result, r.Message)
+}
+
+// Bind binds the invitation code to the logged in user. The error is only set
+// when the request itself failed, a rejected code is reported by the result.
+func (c *Client) Bind(ctx context.Context, code string) (BindResult, error) {
+	_, err := c.Login(ctx, false)
 	if err != nil {
-		return false, err
+		return BindResult{}, err
 	}
 
 	u, err := url.Parse(c.Server)
 	if err != nil {
-		return false, err
+		return BindResult{}, err
 	}
 	u.Path = path.Join(u.Path, "bindInvitation")
 	q := u.Query()
@@ -226,92 +402,85 @@ func (c *Client) Bind(ctx context.Context, code string) (bool, error) {
 
 	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
-		return false, err
+		return BindResult{}, err
 	}
-	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.token.JWT))
-	hc := &http.Client{}
+	c.authorize(request)
+	hc := newHTTPClient()
 	resp, err := hc.Do(request)
 	if err != nil {
-		return false, err
+		return BindResult{}, err
 	}
 	defer resp.Body.Close()
 	log.Printf("Status: %s", resp.Status)
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return false, err
+		return BindResult{}, err
 	}
 	log.Printf("Raw response: %s", string(body))
-	var ret struct {
-		State   int
-		Message string `json:"msg"`
-		Data    struct {
-			Result int
-		}
+	var ret resultResponse
+	if err := decode(http.MethodGet, "/bindInvitation", body, &ret, c.strict); err != nil {
+		return BindResult{}, err
 	}
-	if err := json.Unmarshal(body, &ret); err != nil {
-		return false, err
-	}
-	if ret.Data.Result == 1 {
-		return true, nil
-	} else {
-		return false, nil
+	result := BindResult{Bound: ret.Data.Result == 1, Result: ret.Data.Result, Message: ret.Message}
+	if !result.Bound {
+		log.Printf("bind failed, result: %d, message: %s", ret.Data.Result, ret.Message)
 	}
+	return result, nil
 }
 
-func (c *Client) Address(ctx context.Context, protocol, cType int, force bool) (string, error) {
-	_, err := c.Login(false)
-	if err != nil {
-		return "", err
+// ChangePassword changes the password of the logged in user. On success the
+// cached token is invalidated and the client uses the new password from now on.
+// The endpoint is not confirmed against the server API yet.
+func (c *Client) ChangePassword(ctx context.Context, newPassword string) error {
+	if _, err := c.Login(ctx, false); err != nil {
+		return err
 	}
 
 	u, err := url.Parse(c.Server)
 	if err != nil {
-		return "", err
+		return err
 	}
-	u.Path = path.Join(u.Path, "recharge")
-	q := u.Query()
-	q.Set("protocol", strconv.Itoa(protocol))
-	q.Set("protocol", strconv.Itoa(cType))
-	q.Set("force", fmt.Sprintf("%v", force))
-	q.Set("tamptime", strconv.FormatInt(time.Now().Unix()*1000, 10))
-	u.RawQuery = q.Encode()
-
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	u.Path = path.Join(u.Path, "changePassword")
+	log.Printf("request URL %s", u)
+	c.mu.Lock()
+	password := c.cfg.Password
+	c.mu.Unlock()
+	request := changePasswordRequest{
+		Password:    password,
+		NewPassword: newPassword,
+		Timestamp:   strconv.FormatInt(time.Now().Unix()*1000, 10),
+	}
+	b, _ := json.Marshal(request)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewBuffer(b))
 	if err != nil {
-		return "", err
+		return err
 	}
-	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.token.JWT))
-	hc := &http.Client{}
-	resp, err := hc.Do(request)
+	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req)
+	hc := newHTTPClient()
+	resp, err := hc.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer resp.Body.Close()
 	log.Printf("Status: %s", resp.Status)
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return err
 	}
 	log.Printf("Raw response: %s", string(body))
-	var ret struct {
-		State   int
-		Message string `json:"msg"`
-		Data    struct {
-			Result   int
-			Protocol int
-			Type     int
-			Address  string `json:"addressText"`
-			Remarks  string `json:"remarks"`
-		}
+	var ret resultResponse
+	if err = decode(http.MethodPost, "/changePassword", body, &ret, c.strict); err != nil {
+		return err
 	}
-	if err := json.Unmarshal(body, &ret); err != nil {
-		return "", err
-	}
-	if ret.State == 200 {
-		return ret.Data.Address, nil
-	} else {
-		return "", nil
+	if ret.Data.Result != 1 {
+		return errors.New(ret.Message)
 	}
+
+	c.mu.Lock()
+	c.cfg.Password = newPassword
+	c.mu.Unlock()
+	return c.removeToken()
 }
 
 func pagingRequest(server, relativePath string, start, end int64, page, pageSize int) (string, error) {
@@ -339,13 +508,13 @@ func pagingRequest(server, relativePath string, start, end int64, page, pageSize
 	return u.String(), nil
 }
 
-func getRecords(ctx context.Context, url, token string) ([]byte, error) {
+func (c *Client) getRecords(ctx context.Context, url string) ([]byte, error) {
 	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	hc := &http.Client{}
+	c.authorize(request)
+	hc := newHTTPClient()
 	resp, err := hc.Do(request)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caitan-app/ciac/client/cassette"
+)
+
+func TestParseExpire(t *testing.T) {
+	now := time.Date(2021, 8, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		expire    string
+		remaining time.Duration
+		want      time.Time
+	}{
+		{"2021-08-30 12:00:00", 0, time.Date(2021, 8, 30, 12, 0, 0, 0, time.Local)},
+		{"2021-08-30", 0, time.Date(2021, 8, 30, 0, 0, 0, 0, time.Local)},
+		{"1630324800000", 0, time.Unix(1630324800, 0)},
+		{"", 48 * time.Hour, now.Add(48 * time.Hour)},
+		{"next month", time.Hour, now.Add(time.Hour)},
+	}
+	for i, tt := range tests {
+		if got := parseExpire(tt.expire, tt.remaining, now); !got.Equal(tt.want) {
+			t.Errorf("[%d] parseExpire(%q) = %s, want %s", i, tt.expire, got, tt.want)
+		}
+	}
+}
+
+func TestProfileJSON(t *testing.T) {
+	p := Profile{Email: "a@example.com", ExpireAt: time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC), RemainingTime: 24 * time.Hour}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"remainingTime":"24h0m0s"`) {
+		t.Errorf("json = %s", data)
+	}
+	var got Profile
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != p {
+		t.Errorf("round trip = %+v, want %+v", got, p)
+	}
+}
+
+// TestAllPagesCapped walks the pages of a server returning at most 2
+// records per page whatever pagerNum asks for. A concurrency below 1 is taken
+// as 1.
+func TestAllPagesCapped(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "jwt", Value: "token", MaxAge: 3600})
+			_, _ = w.Write([]byte(`{"state":200,"msg":"ok","data":{"result":1}}`))
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("pager"))
+		var records []string
+		for i := page * 2; i < page*2+2 && i < 5; i++ {
+			records = append(records, fmt.Sprintf(`{"nickName":"user%d","rewardType":1,"rewardNumber":1,"rewardUnit":1,"rewardTime":0}`, i))
+		}
+		fmt.Fprintf(w, `{"state":200,"msg":"ok","data":{"result":1,"record":[%s]}}`, strings.Join(records, ","))
+	}))
+	defer server.Close()
+
+	for _, concurrency := range []int{-1, 0, 1, 2, 4} {
+		cfg := Config{Email: "a@example.com", Password: "p", TokenFile: filepath.Join(t.TempDir(), "token.json")}
+		c := New(cfg, server.URL, WithConcurrency(concurrency))
+		records, err := c.AllInvitationRecords(context.Background(), 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 5 || records[4].NickName != "user4" {
+			t.Errorf("concurrency %d: records = %+v", concurrency, records)
+		}
+	}
+}
+
+func TestReplaySession(t *testing.T) {
+	replayer, err := cassette.NewReplayer("testdata/session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTransport(replayer)
+	defer SetTransport(nil)
+
+	cfg := Config{
+		Email:     "user@example.com",
+		Password:  "password",
+		TokenFile: filepath.Join(t.TempDir(), "token.json"),
+	}
+	c := New(cfg, "https://test.caitan.app", WithStrictDecoding(true))
+	ctx := context.Background()
+
+	token, err := c.Login(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.JWT != "REDACTED" {
+		t.Errorf("token = %s", token.JWT)
+	}
+	profile, err := c.UserInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Code != "AB12cd" || profile.RemainingTime != 24*time.Hour {
+		t.Errorf("profile = %+v", profile)
+	}
+	invitations, err := c.InvitationRecords(ctx, 0, 0, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invitations) != 2 || invitations[1].NickName != "bob" {
+		t.Errorf("invitation records = %+v", invitations)
+	}
+	recharges, err := c.RechargeRecords(ctx, 0, 0, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recharges) != 1 || recharges[0].Symbol != "USDT" {
+		t.Errorf("recharge records = %+v", recharges)
+	}
+	addr, err := c.Address(ctx, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AddressEntry{Pair: Pair{0, 0}, Address: "0xdepositaddress", Remarks: "deposit address"}
+	if addr != want {
+		t.Errorf("address = %+v, want %+v", addr, want)
+	}
+	result, err := c.Bind(ctx, "XY34ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Bound {
+		t.Errorf("bind result = %s", result)
+	}
+}
@@ -1,16 +1,20 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -31,13 +35,28 @@ func (c *Client) loadToken() (*Token, error) {
 
 func (c *Client) saveToken(token *Token) error {
 	data, _ := json.Marshal(token)
-	if err := ioutil.WriteFile(c.cfg.TokenFile, data, 0644); err != nil {
+	if err := os.MkdirAll(filepath.Dir(c.cfg.TokenFile), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.cfg.TokenFile, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file, older versions wrote 0644
+	return os.Chmod(c.cfg.TokenFile, 0600)
+}
+
+// removeToken drops the cached token, both in memory and on disk.
+func (c *Client) removeToken() error {
+	c.mu.Lock()
+	c.token = nil
+	c.mu.Unlock()
+	if err := os.Remove(c.cfg.TokenFile); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 	return nil
 }
 
-func (c *Client) login() (*Token, error) {
+func (c *Client) login(ctx context.Context) (*Token, error) {
 	u, err := url.Parse(c.Server)
 	if err != nil {
 		return nil, err
@@ -45,11 +64,11 @@ func (c *Client) login() (*Token, error) {
 	u.Path = path.Join(u.Path, "login")
 	log.Printf("request URL %s", u)
 
-	return login(u.String(), c.Email(), c.cfg.Password)
+	return login(ctx, u.String(), c.Email(), c.cfg.Password, c.strict)
 }
 
-func (c *Client) loginAndSave() (*Token, error) {
-	token, err := c.login()
+func (c *Client) loginAndSave(ctx context.Context) (*Token, error) {
+	token, err := c.login(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -62,17 +81,13 @@ func (c *Client) loginAndSave() (*Token, error) {
 	return token, nil
 }
 
-func login(url, email, password string) (*Token, error) {
-	request := struct {
-		Email     string `json:"mail"`
-		Password  string `json:"pwd"`
-		Timestamp string `json:"tamptime"`
-	}{
+func login(ctx context.Context, url, email, password string, strict bool) (*Token, error) {
+	request := loginRequest{
 		Email:     email,
 		Password:  password,
 		Timestamp: strconv.FormatInt(time.Now().Unix()*1000, 10),
 	}
-	resp, err := post(url, request)
+	resp, err := post(ctx, url, request)
 	if err != nil {
 		return nil, err
 	}
@@ -84,49 +99,79 @@ func login(url, email, password string) (*Token, error) {
 		return nil, err
 	}
 
-	var ret struct {
-		State   int
-		Message string `json:"msg"`
-		Data    struct {
-			Result int
-			IV     int `json:"IV"`
-		}
-	}
-	if err = json.Unmarshal(body, &ret); err != nil {
+	var ret loginResponse
+	if err = decode(http.MethodPost, "/login", body, &ret, strict); err != nil {
 		return nil, err
 	}
 	log.Printf("Response:\n%s", BeautifyJson(ret))
 	if ret.Data.Result != 1 {
 		return nil, errors.New(ret.Message)
 	}
-	cookie := resp.Header["Set-Cookie"]
-	if cookie == nil || len(cookie) < 1 {
-		return nil, errors.New("no cookie")
+	token, err := tokenFromCookies(resp.Cookies(), time.Now())
+	if err != nil {
+		return nil, err
 	}
-	token := parseToken(cookie[0])
 	log.Printf("Cookie:\n%s", BeautifyJson(token))
 
 	return &token, nil
 }
 
-func parseToken(cookie string) Token {
-	kvs := strings.Split(cookie, "; ")
+// jwtCookie is the name of the session cookie set by login.
+const jwtCookie = "jwt"
+
+// tokenFromCookies finds the jwt cookie among the cookies set by login. The
+// expiry comes from Max-Age if present, otherwise from Expires.
+func tokenFromCookies(cookies []*http.Cookie, now time.Time) (Token, error) {
 	var token Token
-	for _, kv := range kvs {
-		tuple := strings.Split(kv, "=")
-		if len(tuple) != 2 {
-			continue
+	found := false
+	for _, cookie := range cookies {
+		// store an absolute expiry, Max-Age is relative to the response
+		if cookie.MaxAge > 0 {
+			cookie.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+			cookie.MaxAge = 0
+		} else if cookie.MaxAge < 0 {
+			cookie.Expires = now
+			cookie.MaxAge = 0
 		}
+		cookie.RawExpires = ""
+		cookie.Raw = ""
+		token.Cookies = append(token.Cookies, cookie)
 
-		if tuple[0] == "jwt" {
-			token.JWT = tuple[1]
-		} else if tuple[0] == "Max-Age" {
-			age, err := strconv.Atoi(tuple[1])
-			if err != nil {
-				continue
-			}
-			token.ExpireAt = time.Now().Add(time.Second * time.Duration(age))
+		if cookie.Name == jwtCookie && !found {
+			found = true
+			token.JWT = cookie.Value
+			token.ExpireAt = cookie.Expires
 		}
 	}
-	return token
+	if !found || token.JWT == "" {
+		return token, errors.New("no jwt cookie")
+	}
+	return token, nil
+}
+
+// parseToken parses Set-Cookie header values.
+func parseToken(setCookies ...string) (Token, error) {
+	resp := http.Response{Header: http.Header{"Set-Cookie": setCookies}}
+	return tokenFromCookies(resp.Cookies(), time.Now())
+}
+
+// authorize adds the token to the request, and the session cookies matching
+// the request URL if the config asks for them.
+func (c *Client) authorize(request *http.Request) {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+	request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token.JWT))
+	if !c.cfg.SendCookie || len(token.Cookies) == 0 {
+		return
+	}
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return
+	}
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(u, token.Cookies)
+	for _, cookie := range jar.Cookies(request.URL) {
+		request.AddCookie(cookie)
+	}
 }
@@ -0,0 +1,24 @@
+//go:build go1.18
+// +build go1.18
+
+package client
+
+import "testing"
+
+func FuzzParseToken(f *testing.F) {
+	f.Add("jwt=abc.def.ghi; Path=/; Max-Age=604800")
+	f.Add("jwt=a=b; Expires=Wed, 01 Sep 2021 00:00:00 GMT; Secure; Domain=caitan.app")
+	f.Add("lang=en;Path=/")
+	f.Fuzz(func(t *testing.T, cookie string) {
+		token, err := parseToken(cookie)
+		if err != nil {
+			return
+		}
+		if token.JWT == "" {
+			t.Errorf("empty jwt without error for %q", cookie)
+		}
+		if len(token.Cookies) == 0 {
+			t.Errorf("no cookies kept for %q", cookie)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// ForEach calls fn for i in [0, n) with at most concurrency calls running at
+// a time and returns the error of each call by index. Callers keep results in
+// a slice indexed by i, so the output order does not depend on scheduling.
+// Calls not yet started when ctx is done get ctx.Err().
+func ForEach(ctx context.Context, concurrency, n int, fn func(ctx context.Context, i int) error) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := make([]error, n)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			for ; i < n; i++ {
+				errs[i] = ctx.Err()
+			}
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// FirstError returns the first non-nil error.
+func FirstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
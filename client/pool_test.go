@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEach(t *testing.T) {
+	var running, peak int32
+	results := make([]int, 10)
+	errs := ForEach(context.Background(), 3, len(results), func(ctx context.Context, i int) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		results[i] = i * i
+		if i == 7 {
+			return errors.New("seven")
+		}
+		return nil
+	})
+	if peak > 3 {
+		t.Errorf("%d calls at a time, want at most 3", peak)
+	}
+	for i, r := range results {
+		if r != i*i {
+			t.Errorf("results[%d] = %d", i, r)
+		}
+	}
+	if FirstError(errs) == nil || errs[7] == nil || errs[6] != nil {
+		t.Errorf("errs = %v", errs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs = ForEach(ctx, 1, 3, func(ctx context.Context, i int) error { return nil })
+	if !errors.Is(FirstError(errs), context.Canceled) {
+		t.Errorf("canceled: %v", errs)
+	}
+}
@@ -2,7 +2,9 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,56 +15,57 @@ import (
 	"time"
 )
 
-type RespTimestamp struct {
-	State   int
-	Message string `json:"msg"`
-	Data    struct {
-		Result    int
-		Timestamp int64
-	}
+// publicStrict is the strict decoding of the functions not using a Client.
+var publicStrict bool
+
+// SetStrictDecoding sets the strict decoding of Timestamp, SendCode, Register
+// and ResetPassword, see WithStrictDecoding.
+func SetStrictDecoding(strict bool) {
+	publicStrict = strict
 }
 
-func Timestamp(server string) (int64, error) {
+func Timestamp(ctx context.Context, server string) (int64, error) {
 	u, err := url.Parse(server)
 	if err != nil {
-		log.Fatalf("bad server url: %s, error: %s", server, err)
+		return 0, fmt.Errorf("bad server url %s: %w", server, err)
 	}
 	u.Path = path.Join(u.Path, "timestamp")
 	log.Printf("request URL %s", u)
 
-	resp, err := http.Get(u.String())
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := newHTTPClient().Do(request)
 	if err != nil {
-		log.Fatalf("request server %s error: %s", server, err)
+		return 0, err
 	}
 	defer resp.Body.Close()
 	log.Printf("Status: %s", resp.Status)
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("parse response error: %s", err)
+		return 0, err
 	}
 	var timestamp RespTimestamp
-	if err = json.Unmarshal(body, &timestamp); err != nil {
+	if err = decode(http.MethodGet, "/timestamp", body, &timestamp, publicStrict); err != nil {
 		return 0, err
 	}
 	log.Printf("Response:\n%s", BeautifyJson(timestamp))
 	return timestamp.Data.Timestamp, nil
 }
 
-func SendCode(server, email string) error {
+func SendCode(ctx context.Context, server, email string) error {
 	u, err := url.Parse(server)
 	if err != nil {
 		return err
 	}
 	u.Path = path.Join(u.Path, "sendCode")
 	log.Printf("request URL %s", u)
-	request := struct {
-		Email     string `json:"mail"`
-		Timestamp string `json:"tamptime"`
-	}{
+	request := sendCodeRequest{
 		Email:     email,
 		Timestamp: strconv.FormatInt(time.Now().Unix()*1000, 10),
 	}
-	resp, err := post(u.String(), request)
+	resp, err := post(ctx, u.String(), request)
 	if err != nil {
 		return err
 	}
@@ -73,41 +76,69 @@ func SendCode(server, email string) error {
 		return err
 	}
 
-	var ret struct {
-		State   int
-		Message string `json:"msg"`
-		Data    struct {
-			Result int
-		}
-	}
-	if err = json.Unmarshal(body, &ret); err != nil {
+	var ret resultResponse
+	if err = decode(http.MethodPost, "/sendCode", body, &ret, publicStrict); err != nil {
 		return err
 	}
 	log.Printf("Response:\n%s", BeautifyJson(ret))
+	if ret.Data.Result != 1 {
+		return errors.New(ret.Message)
+	}
 	return nil
 }
 
-func Register(server, email, password, verify, invite string) error {
+func Register(ctx context.Context, server, email, password, verify, invite string) error {
 	u, err := url.Parse(server)
 	if err != nil {
 		return err
 	}
 	u.Path = path.Join(u.Path, "register")
 	log.Printf("request URL %s", u)
-	request := struct {
-		Email      string `json:"mail"`
-		Password   string `json:"pwd"`
-		VerifyCode string `json:"code,omitempty"`
-		InviteCode string `json:"invitationCode,omitempty"`
-		Timestamp  string `json:"tamptime"`
-	}{
+	request := registerRequest{
 		Email:      email,
 		Password:   password,
 		VerifyCode: verify,
 		InviteCode: invite,
 		Timestamp:  strconv.FormatInt(time.Now().Unix()*1000, 10),
 	}
-	resp, err := post(u.String(), request)
+	resp, err := post(ctx, u.String(), request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	log.Printf("Status: %s", resp.Status)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var ret resultResponse
+	if err = decode(http.MethodPost, "/register", body, &ret, publicStrict); err != nil {
+		return err
+	}
+	log.Printf("Response:\n%s", BeautifyJson(ret))
+	if ret.Data.Result != 1 {
+		return errors.New(ret.Message)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password for email, verify is the code sent by SendCode.
+// The endpoint is not confirmed against the server API yet.
+func ResetPassword(ctx context.Context, server, email, verify, password string) error {
+	u, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, "resetPassword")
+	log.Printf("request URL %s", u)
+	request := resetPasswordRequest{
+		Email:      email,
+		Password:   password,
+		VerifyCode: verify,
+		Timestamp:  strconv.FormatInt(time.Now().Unix()*1000, 10),
+	}
+	resp, err := post(ctx, u.String(), request)
 	if err != nil {
 		return err
 	}
@@ -118,17 +149,14 @@ func Register(server, email, password, verify, invite string) error {
 		return err
 	}
 
-	var ret struct {
-		State   int
-		Message string `json:"msg"`
-		Data    struct {
-			Result int
-		}
-	}
-	if err = json.Unmarshal(body, &ret); err != nil {
+	var ret resultResponse
+	if err = decode(http.MethodPost, "/resetPassword", body, &ret, publicStrict); err != nil {
 		return err
 	}
 	log.Printf("Response:\n%s", BeautifyJson(ret))
+	if ret.Data.Result != 1 {
+		return errors.New(ret.Message)
+	}
 	return nil
 }
 
@@ -137,9 +165,13 @@ func BeautifyJson(v interface{}) string {
 	return fmt.Sprintf("%s", string(data))
 }
 
-func post(url string, request interface{}) (*http.Response, error) {
+func post(ctx context.Context, url string, request interface{}) (*http.Response, error) {
 	log.Printf("Request:\n%s", BeautifyJson(request))
 	b, _ := json.Marshal(request)
-	r := bytes.NewBuffer(b)
-	return http.Post(url, "application/json", r)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(b))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	return newHTTPClient().Do(r)
 }
@@ -0,0 +1,240 @@
+package client
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// The subset of OpenAPI needed to check responses against the spec.
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+}
+
+type parameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type media struct {
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type operation struct {
+	Parameters  []parameter      `json:"parameters"`
+	RequestBody *media           `json:"requestBody"`
+	Responses   map[string]media `json:"responses"`
+}
+
+type spec struct {
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Parameters map[string]parameter `json:"parameters"`
+		Schemas    map[string]*schema   `json:"schemas"`
+	} `json:"components"`
+}
+
+var (
+	apiSpecOnce sync.Once
+	apiSpec     spec
+)
+
+// loadSpec parses the embedded spec, it is checked by the tests so an error
+// can only come from a broken build.
+func loadSpec() *spec {
+	apiSpecOnce.Do(func() {
+		if err := json.Unmarshal(openAPI, &apiSpec); err != nil {
+			panic(fmt.Sprintf("bad embedded openapi.json: %s", err))
+		}
+	})
+	return &apiSpec
+}
+
+func (s *spec) resolve(sc *schema) *schema {
+	for sc != nil && sc.Ref != "" {
+		sc = s.Components.Schemas[strings.TrimPrefix(sc.Ref, "#/components/schemas/")]
+	}
+	return sc
+}
+
+func schemaOf(m *media) *schema {
+	if m == nil {
+		return nil
+	}
+	return m.Content["application/json"].Schema
+}
+
+// response returns the schema of the successful response of an endpoint.
+func (s *spec) response(method, path string) *schema {
+	op, ok := s.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return nil
+	}
+	resp := op.Responses["200"]
+	return s.resolve(schemaOf(&resp))
+}
+
+// validate appends the differences between v, decoded into interface{}, and
+// the schema. A null matches any schema.
+func (s *spec) validate(problems []string, where string, v interface{}, sc *schema) []string {
+	sc = s.resolve(sc)
+	if sc == nil || v == nil {
+		return problems
+	}
+	field := func(name string) string {
+		if where == "" {
+			return name
+		}
+		return where + "." + name
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if sc.Type != "object" {
+			break
+		}
+		for _, name := range sc.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, "missing field "+field(name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p, ok := sc.Properties[name]
+			if !ok {
+				problems = append(problems, "unexpected field "+field(name))
+				continue
+			}
+			problems = s.validate(problems, field(name), v[name], p)
+		}
+		return problems
+	case []interface{}:
+		if sc.Type != "array" {
+			break
+		}
+		for i, item := range v {
+			problems = s.validate(problems, fmt.Sprintf("%s[%d]", where, i), item, sc.Items)
+		}
+		return problems
+	case string:
+		if sc.Type == "string" {
+			return problems
+		}
+	case bool:
+		if sc.Type == "boolean" {
+			return problems
+		}
+	case float64:
+		if sc.Type == "number" || sc.Type == "integer" && v == math.Trunc(v) {
+			return problems
+		}
+	}
+	return append(problems, fmt.Sprintf("%s is %s, want %s", where, jsonType(v), sc.Type))
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "null"
+}
+
+// SchemaError reports a response which does not match the API spec.
+type SchemaError struct {
+	Endpoint string
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("response of %s does not match the API spec: %s", e.Endpoint, strings.Join(e.Problems, "; "))
+}
+
+// checkResponse compares a response body with the spec of the endpoint.
+// The data of a failed request (result is not 1) may be incomplete, so only
+// unexpected fields are reported for it.
+func checkResponse(method, path string, body []byte) []string {
+	s := loadSpec()
+	sc := s.response(method, path)
+	if sc == nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil // reported by the caller
+	}
+	problems := s.validate(nil, "", v, sc)
+
+	var envelope resultResponse
+	if json.Unmarshal(body, &envelope) == nil && envelope.Data.Result == 1 {
+		return problems
+	}
+	var kept []string
+	for _, p := range problems {
+		if !strings.HasPrefix(p, "missing field data.") {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// warned remembers the problems already warned about, to warn once only.
+var warned sync.Map
+
+// indexPattern matches the array indices in the field of a problem.
+var indexPattern = regexp.MustCompile(`\[[0-9]+\]`)
+
+// warnKey identifies a problem of an endpoint whatever record it was found
+// in, data.record[3].amount and data.record[7].amount are the same field.
+func warnKey(method, path, problem string) string {
+	return method + " " + path + " " + indexPattern.ReplaceAllString(problem, "[]")
+}
+
+// decode unmarshals the response of an endpoint into v. In strict mode a
+// response not matching the spec is an error, otherwise a warning is logged
+// once per endpoint and field.
+func decode(method, path string, body []byte, v interface{}, strict bool) error {
+	if problems := checkResponse(method, path, body); len(problems) > 0 {
+		err := &SchemaError{Endpoint: path, Problems: problems}
+		if strict {
+			return err
+		}
+		for _, p := range problems {
+			if _, seen := warned.LoadOrStore(warnKey(method, path, p), true); !seen {
+				log.Printf("warning: %s", err)
+				break
+			}
+		}
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		path string
+		body string
+		want []string
+	}{
+		{"/invitationRecord", `{"state":200,"msg":"ok","data":{"result":1,"record":[]}}`, nil},
+		{"/invitationRecord", `{"state":200,"msg":"ok","data":{"result":1,"records":[]}}`,
+			[]string{"missing field data.record", "unexpected field data.records"}},
+		{"/rechargeRecord", `{"state":200,"msg":"ok","data":{"result":1,"record":[{"rechargeFor":1,"rechargeFrom":"a","rechargeTo":"b",` +
+			`"rechargeNumber":1.5,"rechargeUnit":1,"rechargeTime":"1627392295000","chain":"TRON","amount":1.5,"symbol":"USDT","arrivalTime":null}]}}`,
+			[]string{"data.record[0].rechargeTime is string, want integer"}},
+		{"/recharge", `{"state":200,"msg":"ok","data":{"result":1,"protocol":0,"type":0,"address":"0x"}}`,
+			[]string{"missing field data.addressText", "unexpected field data.address"}},
+		// a failed request has no data beyond the result
+		{"/recharge", `{"state":200,"msg":"no such type","data":{"result":0}}`, nil},
+	}
+	for i, tt := range tests {
+		if got := checkResponse(http.MethodGet, tt.path, []byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("[%d] %s: got %q, want %q", i, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	body := []byte(`{"state":200,"msg":"ok","data":{"result":1,"records":[{"nickName":"alice"}]}}`)
+	var resp invitationRecordResponse
+	err := decode(http.MethodGet, "/invitationRecord", body, &resp, true)
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || len(schemaErr.Problems) != 2 {
+		t.Errorf("strict: got %v", err)
+	}
+	if err = decode(http.MethodGet, "/invitationRecord", body, &resp, false); err != nil || resp.Data.Result != 1 {
+		t.Errorf("lenient: got %v, %+v", err, resp)
+	}
+}
+
+func TestWarnKey(t *testing.T) {
+	a := warnKey(http.MethodGet, "/rechargeRecord", "data.record[0].rechargeTime is string, want integer")
+	b := warnKey(http.MethodGet, "/rechargeRecord", "data.record[12].rechargeTime is string, want integer")
+	if a != b {
+		t.Errorf("keys differ by record index: %q, %q", a, b)
+	}
+	if c := warnKey(http.MethodGet, "/invitationRecord", "data.record[0].rechargeTime is string, want integer"); c == a {
+		t.Errorf("keys of different endpoints are equal: %q", c)
+	}
+}
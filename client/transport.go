@@ -0,0 +1,21 @@
+package client
+
+import "net/http"
+
+// transport is used by every request of the package, nil means http.DefaultTransport.
+var transport http.RoundTripper
+
+// SetTransport replaces the transport of all requests sent by the package,
+// e.g. to record or replay them with the cassette package.
+func SetTransport(rt http.RoundTripper) {
+	transport = rt
+}
+
+// Transport returns the transport set by SetTransport, nil means http.DefaultTransport.
+func Transport() http.RoundTripper {
+	return transport
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: transport}
+}
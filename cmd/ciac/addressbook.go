@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/caitan-app/ciac/addressbook"
+	"github.com/caitan-app/ciac/client"
+	"github.com/urfave/cli/v2"
+)
+
+var addressHistoryCommand = &cli.Command{
+	Action:    addressHistory,
+	Name:      "history",
+	Usage:     "List the recharge addresses seen for the account, or the owners of an address",
+	ArgsUsage: "[address]",
+}
+
+// addressBookMu serializes the updates of the address book, e.g. from the
+// refreshes of the tui. Other processes are kept out by addressbook.Update.
+var addressBookMu sync.Mutex
+
+func addressBookFile(c *cli.Context) (string, error) {
+	if filename := c.String(AddressBookFlag.Name); filename != "" {
+		return filename, nil
+	}
+	return addressbook.DefaultFile()
+}
+
+func openAddressBook(c *cli.Context) (*addressbook.Book, error) {
+	filename, err := addressBookFile(c)
+	if err != nil {
+		return nil, err
+	}
+	return addressbook.Open(filename)
+}
+
+// recordAddress keeps an address returned by the server in the address book
+// and warns if it differs from the one seen before for the same pair.
+// Failing to update the book does not fail the command.
+func recordAddress(c *cli.Context, profile string, endpoint *client.Client, entry client.AddressEntry, forced bool) {
+	if entry.Address == "" {
+		return
+	}
+	filename, err := addressBookFile(c)
+	if err != nil {
+		log.Printf("open address book error: %s", err)
+		return
+	}
+	addressBookMu.Lock()
+	defer addressBookMu.Unlock()
+	var previous *addressbook.Entry
+	err = addressbook.Update(filename, func(book *addressbook.Book) error {
+		previous = book.Record(addressbook.Entry{
+			Server:   endpoint.Server,
+			Email:    endpoint.Email(),
+			Profile:  profile,
+			Protocol: entry.Protocol,
+			Type:     entry.Type,
+			Address:  entry.Address,
+			Forced:   forced,
+		}, time.Now())
+		return nil
+	})
+	if err != nil {
+		log.Printf("update address book error: %s", err)
+	}
+	if previous == nil {
+		return
+	}
+	if forced {
+		log.Printf("%s address rotated from %s to %s", entry.Pair, previous.Address, entry.Address)
+		return
+	}
+	log.Printf("WARNING: the server returned a different %s address %s, it was %s since %s (possible rotation or compromise)",
+		entry.Pair, entry.Address, previous.Address, previous.FirstSeen.Format("2006-01-02 15:04:05"))
+}
+
+func addressHistory(c *cli.Context) error {
+	book, err := openAddressBook(c)
+	if err != nil {
+		return err
+	}
+	var entries []addressbook.Entry
+	if c.NArg() > 0 {
+		entries = book.Filter("", "", c.Args().First())
+		if len(entries) == 0 {
+			log.Printf("%s is not in the address book", c.Args().First())
+			return nil
+		}
+	} else {
+		s, err := loadConfig(c)
+		if err != nil {
+			return err
+		}
+		for _, e := range book.Filter(s.Email, "", "") {
+			if e.Server == s.Server {
+				entries = append(entries, e)
+			}
+		}
+	}
+	log.Printf("email	profile	protocol	type	address	firstSeen	lastSeen	state")
+	for _, e := range entries {
+		state := "old"
+		if book.Current(e) {
+			state = "current"
+		}
+		if e.Forced {
+			state += ", forced"
+		}
+		log.Printf("%s	%s	%d	%d	%s	%s	%s	%s", e.Email, e.Profile, e.Protocol, e.Type,
+			e.Address, e.FirstSeen.Format("2006-01-02 15:04:05"), e.LastSeen.Format("2006-01-02 15:04:05"), state)
+	}
+	return nil
+}
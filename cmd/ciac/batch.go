@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/batch"
+	"github.com/caitan-app/ciac/client"
+	"github.com/urfave/cli/v2"
+)
+
+// exit code of batch when a step failed
+const batchFailed = 3
+
+var batchCommand = &cli.Command{
+	Action:    runBatch,
+	Name:      "batch",
+	Usage:     "Run a script of operations across profiles and print all results as one document",
+	ArgsUsage: "script.yaml|-",
+	Description: `The script lists steps, each one an op with params for a profile (the
+   --profile one if not set):
+
+   vars:
+     since: 24h
+   onError: continue   # or stop, the default; steps may override it
+   steps:
+     - {op: login, profile: alice}
+     - {name: me, op: user, profile: alice}
+     - {op: recharged, profile: alice, params: {start: "${since}"}}
+     - {op: address, profile: bob, params: {pairs: "1/0,0/0"}}
+
+   ops and their params:
+     timestamp
+     login       force
+     user
+     recharged   start, end (a date, an RFC 3339 time, a duration before now or ms)
+     invited     start, end
+     address     pairs (protocol/type, comma separated, all by default), force,
+                 yes (with force and no pairs: rotate all addresses)
+     bind        code
+
+   ${name} is replaced by a variable, ${step.field} by a field of the result of
+   an earlier named step. Each profile logs in once for the whole script. The
+   document is printed as JSON, or YAML with --output yaml.`,
+	Flags: []cli.Flag{
+		VarFlag,
+	},
+}
+
+// batchOps are the operations of batch scripts.
+func batchOps(c *cli.Context) map[string]batch.Operation {
+	return map[string]batch.Operation{
+		"timestamp": func(ctx context.Context, profile string, p batch.Params) (interface{}, error) {
+			_, server, err := batchClient(c, profile)
+			if err != nil {
+				return nil, err
+			}
+			ts, err := client.Timestamp(ctx, server)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]int64{"timestamp": ts}, nil
+		},
+		"login": func(ctx context.Context, profile string, p batch.Params) (interface{}, error) {
+			endpoint, _, err := batchClient(c, profile)
+			if err != nil {
+				return nil, err
+			}
+			force, err := p.Bool("force")
+			if err != nil {
+				return nil, err
+			}
+			token, err := endpoint.Login(ctx, force)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"email": endpoint.Email(), "expireAt": token.ExpireAt}, nil
+		},
+		"user": func(ctx context.Context, profile string, p batch.Params) (interface{}, error) {
+			endpoint, _, err := batchClient(c, profile)
+			if err != nil {
+				return nil, err
+			}
+			info, err := endpoint.UserInfo(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return info, nil
+		},
+		"recharged": func(ctx context.Context, profile string, p batch.Params) (interface{}, error) {
+			endpoint, _, err := batchClient(c, profile)
+			if err != nil {
+				return nil, err
+			}
+			start, end, err := batchRange(p)
+			if err != nil {
+				return nil, err
+			}
+			records, err := endpoint.AllRechargeRecords(ctx, start, end)
+			if err != nil {
+				return nil, err
+			}
+			if records == nil {
+				records = []client.RechargeRecord{}
+			}
+			return records, nil
+		},
+		"invited": func(ctx context.Context, profile string, p batch.Params) (interface{}, error) {
+			endpoint, _, err := batchClient(c, profile)
+			if err != nil {
+				return nil, err
+			}
+			start, end, err := batchRange(p)
+			if err != nil {
+				return nil, err
+			}
+			records, err := endpoint.AllInvitationRecords(ctx, start, end)
+			if err != nil {
+				return nil, err
+			}
+			if records == nil {
+				records = []client.InvitationRecord{}
+			}
+			return records, nil
+		},
+		"address": func(ctx context.Context, profile string, p batch.Params) (interface{}, error) {
+			endpoint, _, err := batchClient(c, profile)
+			if err != nil {
+				return nil, err
+			}
+			force, err := p.Bool("force")
+			if err != nil {
+				return nil, err
+			}
+			yes, err := p.Bool("yes")
+			if err != nil {
+				return nil, err
+			}
+			pairs := client.ValidPairs
+			v := p.String("pairs", "")
+			// nothing asks before rotating in a script, all of them must be meant
+			if force && v == "" && !yes {
+				return nil, errors.New("force without pairs rotates every address, list the pairs or set yes: true")
+			}
+			if v != "" {
+				pairs = nil
+				for _, s := range strings.Split(v, ",") {
+					pair, err := parsePair(strings.TrimSpace(s))
+					if err != nil {
+						return nil, err
+					}
+					pairs = append(pairs, pair)
+				}
+			}
+			if profile == "" {
+				profile = c.String(ProfileFlag.Name)
+			}
+			entries := []addressOutput{}
+			for _, r := range endpoint.Addresses(ctx, pairs, force) {
+				if r.Err != nil {
+					return nil, fmt.Errorf("%s: %w", r.Pair, r.Err)
+				}
+				recordAddress(c, profile, endpoint, r.AddressEntry, force)
+				entries = append(entries, addressOutput{Profile: profile, Email: endpoint.Email(), AddressEntry: r.AddressEntry})
+			}
+			return entries, nil
+		},
+		"bind": func(ctx context.Context, profile string, p batch.Params) (interface{}, error) {
+			endpoint, _, err := batchClient(c, profile)
+			if err != nil {
+				return nil, err
+			}
+			code := strings.TrimSpace(p.String("code", ""))
+			if code == "" {
+				return nil, errors.New("no invitation code")
+			}
+			result, err := endpoint.Bind(ctx, code)
+			if err != nil {
+				return nil, err
+			}
+			if !result.Bound {
+				return nil, fmt.Errorf("bind failed: %s", result)
+			}
+			return map[string]string{"result": result.String()}, nil
+		},
+	}
+}
+
+// batchClient returns the client of a profile, "" is the --profile one.
+// Clients are kept by newClient, so a profile logs in once per script.
+func batchClient(c *cli.Context, profile string) (*client.Client, string, error) {
+	if profile == "" {
+		profile = c.String(ProfileFlag.Name)
+	}
+	s, err := loadProfile(c, profile)
+	if err != nil {
+		return nil, "", err
+	}
+	return newClient(s.Config, s.Server), s.Server, nil
+}
+
+// batchRange parses the start and end params, 0 if not set.
+func batchRange(p batch.Params) (start, end int64, err error) {
+	now := time.Now()
+	if v := p.String("start", ""); v != "" {
+		if start, err = parseTimeArg(v, now); err != nil {
+			return 0, 0, fmt.Errorf("start: %w", err)
+		}
+	}
+	if v := p.String("end", ""); v != "" {
+		if end, err = parseTimeArg(v, now); err != nil {
+			return 0, 0, fmt.Errorf("end: %w", err)
+		}
+	}
+	return start, end, nil
+}
+
+func runBatch(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: %s batch script.yaml|-", c.App.Name)
+	}
+	var r io.Reader = os.Stdin
+	if name := c.Args().First(); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	script, err := batch.Parse(r)
+	if err != nil {
+		return fmt.Errorf("bad script: %w", err)
+	}
+	vars := make(map[string]string)
+	for _, v := range c.StringSlice(VarFlag.Name) {
+		name, value := v, ""
+		if i := strings.IndexByte(v, '='); i >= 0 {
+			name, value = v[:i], v[i+1:]
+		}
+		if name == "" {
+			return fmt.Errorf("bad --%s %q, want name=value", VarFlag.Name, v)
+		}
+		vars[name] = value
+	}
+	ops := batchOps(c)
+	if err := script.Check(ops); err != nil {
+		return fmt.Errorf("bad script: %w", err)
+	}
+
+	result := batch.Run(c.Context, script, ops, vars)
+	format := output
+	if format == "text" {
+		format = "json"
+	}
+	if err := writeDocument(c.App.Writer, result, format); err != nil {
+		return err
+	}
+	if !result.OK {
+		failed := 0
+		for _, s := range result.Steps {
+			if s.Status != batch.OK {
+				failed++
+			}
+		}
+		return cli.Exit(fmt.Sprintf("%d of %d steps did not succeed", failed, len(result.Steps)), batchFailed)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/caitan-app/ciac/accounting"
+	"github.com/caitan-app/ciac/internal/config"
+	"github.com/caitan-app/ciac/valuation"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	completionCommand = &cli.Command{
+		Action:    completion,
+		Name:      "completion",
+		Usage:     "Print the shell completion script",
+		ArgsUsage: "bash|zsh|fish|powershell",
+	}
+	manCommand = &cli.Command{
+		Action: man,
+		Name:   "man",
+		Usage:  "Print the man page in roff format",
+	}
+)
+
+const bashCompletion = `_ciac_bash_autocomplete() {
+  local cur opts
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if [[ "$cur" == "-"* ]]; then
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} ${cur} --generate-bash-completion 2>/dev/null )
+  else
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion 2>/dev/null )
+  fi
+  COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+  return 0
+}
+
+complete -o bashdefault -o default -F _ciac_bash_autocomplete %[1]s
+`
+
+const zshCompletion = `#compdef %[1]s
+
+_ciac_zsh_autocomplete() {
+  local -a opts
+  local cur
+  cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion 2>/dev/null)}")
+  else
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion 2>/dev/null)}")
+  fi
+
+  if [[ "${opts[1]}" != "" ]]; then
+    _describe 'values' opts
+  else
+    _files
+  fi
+}
+
+compdef _ciac_zsh_autocomplete %[1]s
+`
+
+const powershellCompletion = `Register-ArgumentCompleter -Native -CommandName %[1]s -ScriptBlock {
+  param($wordToComplete, $commandAst, $cursorPosition)
+  $words = $commandAst.CommandElements | ForEach-Object { $_.ToString() }
+  if ($wordToComplete -ne "") {
+    $words = $words[0..($words.Count - 2)]
+  }
+  $line = ($words -join " ") + " --generate-bash-completion"
+  Invoke-Expression $line 2>$null | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+    [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+  }
+}
+`
+
+// fishDynamic completes the flag values fish can not get from the static script.
+const fishDynamic = `
+complete -c %[1]s -l profile -x -a '(%[1]s --profile --generate-bash-completion 2>/dev/null)'
+complete -c %[1]s -l env -x -a '(%[1]s --env --generate-bash-completion 2>/dev/null)'
+complete -c %[1]s -l protocol -x -a '%[2]s'
+complete -c %[1]s -l type -x -a '%[3]s'
+complete -c %[1]s -l code -x -a '(%[1]s --code --generate-bash-completion 2>/dev/null)'
+`
+
+func completion(c *cli.Context) error {
+	name := c.App.Name
+	switch shell := c.Args().First(); shell {
+	case "bash":
+		fmt.Printf(bashCompletion, name)
+	case "zsh":
+		fmt.Printf(zshCompletion, name)
+	case "fish":
+		script, err := c.App.ToFishCompletion()
+		if err != nil {
+			return err
+		}
+		fmt.Print(script)
+		fmt.Printf(fishDynamic, name, strings.Join(idList(protocolIDs), " "), strings.Join(idList(typeIDs), " "))
+	case "powershell":
+		fmt.Printf(powershellCompletion, name)
+	default:
+		return fmt.Errorf("unknown shell %q, supported are bash, zsh, fish and powershell", shell)
+	}
+	return nil
+}
+
+func man(c *cli.Context) error {
+	page, err := c.App.ToMan()
+	if err != nil {
+		return err
+	}
+	fmt.Print(page)
+	return nil
+}
+
+// flagValues returns the completion candidates for the value of a flag, nil
+// if the flag has no dynamic values.
+func flagValues(c *cli.Context, flag string) []string {
+	switch flag {
+	case ProfileFlag.Name, EnvFlag.Name, CodeFlag.Name, BindCodeFlag.Name, InvitationCodeFlag.Name:
+		layers, err := fileLayers(c, true)
+		if err != nil {
+			return nil
+		}
+		files := config.Merge(layers...)
+		switch flag {
+		case ProfileFlag.Name:
+			return files.Profiles()
+		case EnvFlag.Name:
+			return files.Environments()
+		default:
+			return files.InvitationCodes()
+		}
+	case ProtocolFlag.Name:
+		return idList(protocolIDs)
+	case TypeFlag.Name:
+		return idList(typeIDs)
+	case ExportFormatFlag.Name:
+		return accounting.Formats
+	case PeriodFlag.Name:
+		return valuation.Periods
+	case OutputFlag.Name:
+		return outputs
+	case "shell":
+		return []string{"bash", "zsh", "fish", "powershell"}
+	}
+	return nil
+}
+
+// completer completes flag values dynamically, everything else is left to
+// the default completion of commands and flags.
+func completer(cmd *cli.Command) cli.BashCompleteFunc {
+	return func(c *cli.Context) {
+		// the completion flag is the last argument, the word before it is
+		// the flag whose value is completed
+		if n := len(os.Args); n >= 3 {
+			prev := os.Args[n-2]
+			if strings.HasPrefix(prev, "-") {
+				if values := flagValues(c, strings.TrimLeft(prev, "-")); values != nil {
+					for _, v := range values {
+						fmt.Fprintln(c.App.Writer, v)
+					}
+					return
+				}
+			}
+		}
+		if cmd == completionCommand {
+			for _, v := range flagValues(c, "shell") {
+				fmt.Fprintln(c.App.Writer, v)
+			}
+			return
+		}
+		if cmd == nil {
+			cli.DefaultAppComplete(c)
+			return
+		}
+		cli.DefaultCompleteWithFlags(cmd)(c)
+	}
+}
+
+// setupCompletion installs the dynamic completer on the app and all commands.
+func setupCompletion(app *cli.App) {
+	app.EnableBashCompletion = true
+	app.BashComplete = completer(nil)
+	var walk func(commands []*cli.Command)
+	walk = func(commands []*cli.Command) {
+		for _, cmd := range commands {
+			cmd.BashComplete = completer(cmd)
+			walk(cmd.Subcommands)
+		}
+	}
+	walk(app.Commands)
+}
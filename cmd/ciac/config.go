@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+var configCommand = &cli.Command{
+	Name:  "config",
+	Usage: "Show or change the configuration",
+	Subcommands: []*cli.Command{
+		{
+			Action: configShow,
+			Name:   "show",
+			Usage:  "Print the effective configuration, secrets are masked",
+		},
+		{
+			Action:    configGet,
+			Name:      "get",
+			Usage:     "Print the effective value of a key",
+			ArgsUsage: "<key>",
+			Flags: []cli.Flag{
+				RevealFlag,
+			},
+		},
+		{
+			Action:    configSet,
+			Name:      "set",
+			Usage:     "Set a key in the project file if it exists, otherwise in the user file",
+			ArgsUsage: "<key> <value>",
+		},
+		{
+			Action: configPath,
+			Name:   "path",
+			Usage:  "Print the config files in order of precedence",
+		},
+	},
+}
+
+// projectFile returns the file given by --config, or the first config.* in
+// the current directory. Only the former must exist.
+func projectFile(c *cli.Context) (filename string, required bool) {
+	if c.IsSet(ConfigFlag.Name) {
+		return c.String(ConfigFlag.Name), true
+	}
+	return config.Find(".", "config"), false
+}
+
+// fileLayers returns the defaults and the config files. With allowMissing
+// a project file given by --config may not exist yet.
+func fileLayers(c *cli.Context, allowMissing bool) ([]config.Layer, error) {
+	layers := []config.Layer{config.Defaults()}
+
+	if filename, err := config.UserFile(); err == nil {
+		l, err := config.File(filename)
+		if err == nil {
+			layers = append(layers, l)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	filename, required := projectFile(c)
+	l, err := config.File(filename)
+	if err == nil {
+		layers = append(layers, l)
+	} else if (required && !allowMissing) || !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return layers, nil
+}
+
+// configLayers returns all layers for the profile selected by --profile.
+func configLayers(c *cli.Context, allowMissing bool) ([]config.Layer, error) {
+	return profileLayers(c, c.String(ProfileFlag.Name), allowMissing)
+}
+
+// profileLayers returns all layers in order of precedence: defaults, files,
+// the profile and environment sections of the files, CIAC_* variables, flags.
+func profileLayers(c *cli.Context, profile string, allowMissing bool) ([]config.Layer, error) {
+	layers, err := fileLayers(c, allowMissing)
+	if err != nil {
+		return nil, err
+	}
+	files := config.Merge(layers...)
+	if profile != "" {
+		l, err := files.Profile(profile)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	if env := c.String(EnvFlag.Name); env != "" {
+		l, err := files.Environment(env)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+
+	layers = append(layers, config.Env(os.LookupEnv))
+
+	flags := config.Layer{Source: "flags", Values: make(map[string]string)}
+	for key, name := range map[string]string{
+		"server":    ServerFlag.Name,
+		"email":     EmailFlag.Name,
+		"password":  PasswordFlag.Name,
+		"tokenFile": TokenFileFlag.Name,
+	} {
+		if c.IsSet(name) {
+			flags.Values[key] = c.String(name)
+		}
+	}
+	return append(layers, flags), nil
+}
+
+// loadConfig returns the effective configuration of all layers.
+func loadConfig(c *cli.Context) (config.Settings, error) {
+	return loadProfile(c, c.String(ProfileFlag.Name))
+}
+
+// loadProfile returns the effective configuration of a profile, "" means the
+// top level settings.
+func loadProfile(c *cli.Context, profile string) (config.Settings, error) {
+	layers, err := profileLayers(c, profile, false)
+	if err != nil {
+		return config.Settings{}, err
+	}
+	return config.Merge(layers...).Settings()
+}
+
+// saveConfig stores the account in the project file, readable by the owner only.
+func saveConfig(c *cli.Context, cfg client.Config) (string, error) {
+	filename, _ := projectFile(c)
+	values := map[string]string{
+		"email":     cfg.Email,
+		"password":  cfg.Password,
+		"tokenFile": cfg.TokenFile,
+	}
+	return filename, config.Write(filename, values)
+}
+
+func configShow(c *cli.Context) error {
+	layers, err := configLayers(c, true)
+	if err != nil {
+		return err
+	}
+	config.Merge(layers...).Print(os.Stdout)
+	return nil
+}
+
+func configGet(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: %s config get <key>", c.App.Name)
+	}
+	key, err := config.Lookup(c.Args().First())
+	if err != nil {
+		return err
+	}
+	layers, err := configLayers(c, true)
+	if err != nil {
+		return err
+	}
+	value, _, _ := config.Merge(layers...).Get(key.Name)
+	if key.Secret && !c.Bool(RevealFlag.Name) {
+		value = config.Mask(value)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func configSet(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("usage: %s config set <key> <value>", c.App.Name)
+	}
+	key, err := config.Lookup(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	filename, _ := projectFile(c)
+	if _, err := os.Stat(filename); err != nil {
+		if filename, err = config.UserFile(); err != nil {
+			return err
+		}
+	}
+	if err = config.Write(filename, map[string]string{key.Name: c.Args().Get(1)}); err != nil {
+		return err
+	}
+	log.Printf("%s set in %s", key.Name, filename)
+	return nil
+}
+
+func configPath(c *cli.Context) error {
+	user, err := config.UserFile()
+	if err != nil {
+		return err
+	}
+	project, _ := projectFile(c)
+	for _, filename := range []string{user, project} {
+		state := "missing"
+		if _, err := os.Stat(filename); err == nil {
+			state = "found"
+		}
+		fmt.Printf("%s\t(%s)\n", filename, state)
+	}
+	return nil
+}
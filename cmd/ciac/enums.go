@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+var (
+	protocolIDs = client.Protocols()
+	typeIDs     = client.Types()
+)
+
+// idList joins ids for messages and completion.
+func idList(ids []int) []string {
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.Itoa(id)
+	}
+	return list
+}
+
+// parseEnum accepts one of the known ids.
+func parseEnum(ids []int, s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad id %q, valid ids are %s", s, strings.Join(idList(ids), ", "))
+	}
+	for _, known := range ids {
+		if id == known {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown id %d, valid ids are %s", id, strings.Join(idList(ids), ", "))
+}
+
+// parseEnums parses all values, nil values means all ids.
+func parseEnums(ids []int, values []string) ([]int, error) {
+	if len(values) == 0 {
+		return ids, nil
+	}
+	var list []int
+	for _, v := range values {
+		id, err := parseEnum(ids, v)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, id)
+	}
+	return list, nil
+}
+
+// parsePair parses a protocol/type pair of ids like 1/0.
+func parsePair(s string) (client.Pair, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return client.Pair{}, fmt.Errorf("bad pair %q, want protocol/type", s)
+	}
+	p, err := parseEnum(protocolIDs, parts[0])
+	if err != nil {
+		return client.Pair{}, fmt.Errorf("bad protocol in %q: %w", s, err)
+	}
+	t, err := parseEnum(typeIDs, parts[1])
+	if err != nil {
+		return client.Pair{}, fmt.Errorf("bad type in %q: %w", s, err)
+	}
+	pair := client.Pair{Protocol: p, Type: t}
+	if !pair.Valid() {
+		return client.Pair{}, fmt.Errorf("%s is not a valid protocol/type pair", s)
+	}
+	return pair, nil
+}
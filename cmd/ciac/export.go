@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/caitan-app/ciac/accounting"
+	"github.com/caitan-app/ciac/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+var exportCommand = &cli.Command{
+	Action: export,
+	Name:   "export",
+	Usage:  "Export deposits and invitation rewards as accounting entries",
+	Description: `Account names are taken from the "accounts" section of the config
+   files, e.g. "deposit:TRON:USDT: Assets:Crypto:Tron:USDT". Entries keep
+   the same ID when exported again, so importers can skip duplicates.`,
+	Flags: []cli.Flag{
+		ExportFormatFlag,
+		StartFlag,
+		EndFlag,
+		FileFlag,
+	},
+}
+
+func export(c *cli.Context) error {
+	layers, err := fileLayers(c, false)
+	if err != nil {
+		return err
+	}
+	accounts := accounting.Accounts(config.Merge(layers...).Accounts())
+
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
+	endpoint := newClient(cfg, server)
+
+	start, end := c.Int64(StartFlag.Name), c.Int64(EndFlag.Name)
+	recharges, err := endpoint.AllRechargeRecords(c.Context, start, end)
+	if err != nil {
+		log.Printf("Get recharge records error: %s", err)
+		return err
+	}
+	invitations, err := endpoint.AllInvitationRecords(c.Context, start, end)
+	if err != nil {
+		log.Printf("Get invitation records error: %s", err)
+		return err
+	}
+	entries := append(accounting.Deposits(recharges, accounts), accounting.Rewards(invitations, accounts)...)
+	accounting.Sort(entries)
+
+	var w io.Writer = os.Stdout
+	if filename := c.String(FileFlag.Name); filename != "" {
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err = accounting.Write(w, c.String(ExportFormatFlag.Name), entries); err != nil {
+		return err
+	}
+	log.Printf("exported %d deposits and %d rewards", len(recharges), len(invitations))
+	return nil
+}
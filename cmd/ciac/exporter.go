@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/exporter"
+	"github.com/caitan-app/ciac/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+var exporterCommand = &cli.Command{
+	Action: runExporter,
+	Name:   "exporter",
+	Usage:  "Serve Prometheus metrics of one or more accounts",
+	Flags: []cli.Flag{
+		ListenFlag,
+		ExporterIntervalFlag,
+		ProfilesFlag,
+		AllProfilesFlag,
+	},
+}
+
+// selectedProfiles returns the profiles chosen by --profiles or
+// --all-profiles, nil means the current account only.
+func selectedProfiles(c *cli.Context) ([]string, error) {
+	if !c.Bool(AllProfilesFlag.Name) {
+		return c.StringSlice(ProfilesFlag.Name), nil
+	}
+	layers, err := fileLayers(c, false)
+	if err != nil {
+		return nil, err
+	}
+	profiles := config.Merge(layers...).Profiles()
+	if len(profiles) == 0 {
+		return nil, errors.New("no profiles configured")
+	}
+	return profiles, nil
+}
+
+// accounts returns a client per selected profile, named after the profile.
+func accounts(c *cli.Context) ([]exporter.Account, error) {
+	profiles, err := selectedProfiles(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		s, err := loadConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		name := c.String(ProfileFlag.Name)
+		if name == "" {
+			name = "default"
+		}
+		return []exporter.Account{{Name: name, Client: newClient(s.Config, s.Server)}}, nil
+	}
+	var list []exporter.Account
+	for _, p := range profiles {
+		s, err := loadProfile(c, p)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, exporter.Account{Name: p, Client: newClient(s.Config, s.Server)})
+	}
+	return list, nil
+}
+
+func runExporter(c *cli.Context) error {
+	interval := c.Duration(ExporterIntervalFlag.Name)
+	if interval <= 0 {
+		return fmt.Errorf("--%s must be positive", ExporterIntervalFlag.Name)
+	}
+	list, err := accounts(c)
+	if err != nil {
+		return err
+	}
+	e := exporter.New(list)
+	client.SetTransport(e.Transport(client.Transport()))
+
+	ctx, cancel := context.WithCancel(c.Context)
+	defer cancel()
+	go e.Run(ctx, interval)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	server := &http.Server{Addr: c.String(ListenFlag.Name), Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	log.Printf("exporting %d account(s) on %s/metrics", len(list), server.Addr)
+	if err = server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
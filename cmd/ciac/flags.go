@@ -1,23 +1,43 @@
 package main
 
-import "github.com/urfave/cli/v2"
+import (
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/accounting"
+	"github.com/caitan-app/ciac/internal/config"
+	"github.com/caitan-app/ciac/valuation"
+	"github.com/urfave/cli/v2"
+)
 
 var (
 	ConfigFlag = &cli.StringFlag{
-		Name:    "config",
-		Aliases: []string{"c"},
-		Value:   "config.json",
-		Usage:   "load configuration from `file`",
+		Name:        "config",
+		Aliases:     []string{"c"},
+		EnvVars:     []string{"CIAC_CONFIG"},
+		DefaultText: "config.{json,yaml,yml,toml} in the current directory",
+		Usage:       "load project configuration from `file`",
 	}
 	ServerFlag = &cli.StringFlag{
-		Name:    "server",
-		Aliases: []string{"s"},
-		Value:   "https://test.caitan.app",
-		Usage:   "connect to `server`",
+		Name:        "server",
+		Aliases:     []string{"s"},
+		DefaultText: config.DefaultServer,
+		Usage:       "connect to `server`",
+	}
+	ProfileFlag = &cli.StringFlag{
+		Name:    "profile",
+		Aliases: []string{"p"},
+		EnvVars: []string{"CIAC_PROFILE"},
+		Usage:   "use the account of profile `name` from the config files",
+	}
+	EnvFlag = &cli.StringFlag{
+		Name:    "env",
+		EnvVars: []string{"CIAC_ENV"},
+		Usage:   "connect to the server of environment `name`",
 	}
 	EmailFlag = &cli.StringFlag{
 		Name:  "email",
-		Usage: "send verification code to `email`",
+		Usage: "account `email`",
 	}
 	ForceFlag = &cli.BoolFlag{
 		Name:    "force",
@@ -51,21 +71,217 @@ var (
 		Value: 10,
 		Usage: "page `size`",
 	}
+	AllFlag = &cli.BoolFlag{
+		Name:  "all",
+		Usage: "fetch all pages",
+	}
 	CodeFlag = &cli.StringFlag{
 		Name:  "code",
 		Usage: "invitation `code`",
 	}
-	ProtocolFlag = &cli.IntSliceFlag{
+	ProtocolFlag = &cli.StringSliceFlag{
 		Name:  "protocol",
-		Usage: "protocols for recharge",
+		Usage: "protocol ids for recharge (0, 1, 2)",
 	}
-	TypeFlag = &cli.IntSliceFlag{
+	TypeFlag = &cli.StringSliceFlag{
 		Name:  "type",
-		Usage: "types for recharge",
+		Usage: "type ids for recharge (0, 1, 2, 3)",
 	}
 	ForceAddressFlag = &cli.BoolFlag{
 		Name:    "force",
 		Aliases: []string{"f"},
-		Usage:   "generate a new address if not exist",
+		Usage:   "ask the server to generate new addresses for the selected pairs",
+	}
+	PasswordFlag = &cli.StringFlag{
+		Name:  "password",
+		Usage: "account `password`",
+	}
+	TokenFileFlag = &cli.StringFlag{
+		Name:        "token-file",
+		DefaultText: "token.json in the user config dir",
+		Usage:       "store the login token in `file`",
+	}
+	BindCodeFlag = &cli.StringFlag{
+		Name:  "bind",
+		Usage: "bind invitation `code` after login",
+	}
+	NonInteractiveFlag = &cli.BoolFlag{
+		Name:  "non-interactive",
+		Usage: "never prompt, take everything from flags",
+	}
+	UnconfirmedAPIFlag = &cli.BoolFlag{
+		Name:    "unconfirmed-api",
+		EnvVars: []string{"CIAC_UNCONFIRMED_API"},
+		Usage:   "use endpoints not confirmed against the server API yet",
+	}
+	OverwriteFlag = &cli.BoolFlag{
+		Name:  "overwrite",
+		Usage: "overwrite the config file if it already exists",
+	}
+	NewPasswordFlag = &cli.StringFlag{
+		Name:  "new-password",
+		Usage: "the new `password`",
+	}
+	CheckFlag = &cli.BoolFlag{
+		Name:  "check",
+		Usage: "exit with 1 when expiring within the warning threshold, 2 when expired, 3 when the state is unknown",
+	}
+	WarnFlag = &cli.DurationFlag{
+		Name:  "warn",
+		Value: 72 * time.Hour,
+		Usage: "warn when the subscription expires within `duration`",
+	}
+	InviteLinkFlag = &cli.StringFlag{
+		Name:  "link",
+		Usage: "shareable invite link `url`, {code} is replaced by the invitation code (default: the inviteLink config key)",
+	}
+	ChartFlag = &cli.BoolFlag{
+		Name:  "chart",
+		Usage: "render the timeline as an ASCII chart",
+	}
+	DryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "only validate, do not change anything on the server",
+	}
+	RecordFlag = &cli.StringFlag{
+		Name:  "record",
+		Usage: "record all HTTP interactions (scrubbed) into `dir`",
+	}
+	ReplayFlag = &cli.StringFlag{
+		Name:  "replay",
+		Usage: "replay HTTP interactions recorded in `dir`, no network access",
+	}
+	StrictFlag = &cli.BoolFlag{
+		Name:    "strict",
+		EnvVars: []string{"CIAC_STRICT"},
+		Usage:   "fail on responses not matching the API spec instead of warning",
+	}
+	ExportFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Value: "csv",
+		Usage: "export as `format`: " + strings.Join(accounting.Formats, ", "),
+	}
+	FileFlag = &cli.StringFlag{
+		Name:        "file",
+		DefaultText: "stdout",
+		Usage:       "write to `file`",
+	}
+	FiatFlag = &cli.StringFlag{
+		Name:  "fiat",
+		Value: "USD",
+		Usage: "value deposits in `currency`",
+	}
+	PricesFlag = &cli.StringFlag{
+		Name:     "prices",
+		Required: true,
+		Usage:    "historical prices from `file` (csv or json)",
+	}
+	PeriodFlag = &cli.StringFlag{
+		Name:  "period",
+		Value: "month",
+		Usage: "sum per `period`: " + strings.Join(valuation.Periods, ", "),
+	}
+	ChainFileFlag = &cli.StringFlag{
+		Name:     "chain-file",
+		Required: true,
+		Usage:    "transfers exported from the chain as CSV `file`",
+	}
+	WindowFlag = &cli.DurationFlag{
+		Name:  "window",
+		Value: time.Hour,
+		Usage: "match transfers at most `duration` before or after the recharge time",
+	}
+	ToleranceFlag = &cli.Float64Flag{
+		Name:  "tolerance",
+		Value: 1e-6,
+		Usage: "treat amounts differing by at most `amount` as equal",
+	}
+	OutlierFlag = &cli.DurationFlag{
+		Name:        "outlier",
+		DefaultText: "3 times the median",
+		Usage:       "report delays above `duration` as outliers",
+	}
+	HistogramFlag = &cli.BoolFlag{
+		Name:  "histogram",
+		Usage: "print a histogram of the delays per chain and symbol",
+	}
+	AddressBookFlag = &cli.StringFlag{
+		Name:        "address-book",
+		EnvVars:     []string{"CIAC_ADDRESS_BOOK"},
+		DefaultText: "addresses.json in the user config dir",
+		Usage:       "keep the recharge addresses seen in `file`",
+	}
+	PairFlag = &cli.StringSliceFlag{
+		Name:  "pair",
+		Usage: "select a protocol/type `pair` of ids like 1/0, may be repeated",
+	}
+	YesFlag = &cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   "do not ask for confirmation",
+	}
+	ConcurrencyFlag = &cli.IntFlag{
+		Name:    "concurrency",
+		EnvVars: []string{"CIAC_CONCURRENCY"},
+		Value:   4,
+		Usage:   "run up to `n` requests at a time for addresses, pages and profiles",
+	}
+	VarFlag = &cli.StringSliceFlag{
+		Name:  "var",
+		Usage: "set the script variable `name=value`, overriding the script's vars",
+	}
+	PluginStdinFlag = &cli.BoolFlag{
+		Name:    "plugin-stdin",
+		EnvVars: []string{"CIAC_PLUGIN_STDIN"},
+		Usage:   "write the context of plugins as JSON to their stdin instead of passing stdin on",
+	}
+	OutputFlag = &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		EnvVars: []string{"CIAC_OUTPUT"},
+		Value:   "text",
+		Usage:   "print results as `format`: " + strings.Join(outputs, ", "),
+	}
+	RevealFlag = &cli.BoolFlag{
+		Name:  "reveal",
+		Usage: "print secrets in clear text",
+	}
+	IntervalFlag = &cli.DurationFlag{
+		Name:  "interval",
+		Value: time.Minute,
+		Usage: "refresh every `duration`",
+	}
+	ListenFlag = &cli.StringFlag{
+		Name:  "listen",
+		Value: ":9742",
+		Usage: "listen on `address`",
+	}
+	ExporterIntervalFlag = &cli.DurationFlag{
+		Name:  "interval",
+		Value: 5 * time.Minute,
+		Usage: "collect every `duration`",
+	}
+	ProfilesFlag = &cli.StringSliceFlag{
+		Name:  "profiles",
+		Usage: "use the accounts of these profiles",
+	}
+	AllProfilesFlag = &cli.BoolFlag{
+		Name:  "all-profiles",
+		Usage: "use the accounts of all profiles",
+	}
+	ServeListenFlag = &cli.StringFlag{
+		Name:  "listen",
+		Value: "127.0.0.1:9743",
+		Usage: "listen on `address`, unix:/path for a Unix socket",
+	}
+	APIKeyFlag = &cli.StringFlag{
+		Name:    "api-key",
+		EnvVars: []string{"CIAC_API_KEY"},
+		Usage:   "API `key` clients must send as bearer token",
+	}
+	APIKeyFileFlag = &cli.StringFlag{
+		Name:        "api-key-file",
+		DefaultText: "gateway.key in the user config dir",
+		Usage:       "read the API key from `file`, a random key is generated if missing",
 	}
 )
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+var initCommand = &cli.Command{
+	Action: initAccount,
+	Name:   "init",
+	Usage:  "Register a new account, login and write the config file",
+	Flags: []cli.Flag{
+		EmailFlag,
+		PasswordFlag,
+		VerificationCodeFlag,
+		InvitationCodeFlag,
+		BindCodeFlag,
+		TokenFileFlag,
+		NonInteractiveFlag,
+		OverwriteFlag,
+	},
+}
+
+// initAccount walks through sendCode, register, login and (optionally) bind.
+// With --non-interactive everything comes from flags: run it once without --vc
+// to get the verification code mailed, then again with --vc to finish.
+func initAccount(c *cli.Context) error {
+	layers, err := configLayers(c, true)
+	if err != nil {
+		return err
+	}
+	s, err := config.Merge(layers...).Settings()
+	if err != nil {
+		return err
+	}
+	server := s.Server
+	log.Printf("Server is %s", server)
+	conf, _ := projectFile(c)
+	interactive := !c.Bool(NonInteractiveFlag.Name)
+	p := newPrompter()
+
+	if _, err := os.Stat(conf); err == nil && !c.Bool(OverwriteFlag.Name) {
+		if !interactive {
+			return fmt.Errorf("config file %s already exists, use --%s to replace it", conf, OverwriteFlag.Name)
+		}
+		ok, err := p.confirm(fmt.Sprintf("Config file %s already exists, overwrite it?", conf))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("aborted")
+		}
+	}
+
+	cfg := s.Config
+	vc := c.String(VerificationCodeFlag.Name)
+	ic := c.String(InvitationCodeFlag.Name)
+	code := c.String(BindCodeFlag.Name)
+
+	if cfg.Email == "" {
+		if !interactive {
+			return fmt.Errorf("--%s is required", EmailFlag.Name)
+		}
+		if cfg.Email, err = p.askRequired("Email"); err != nil {
+			return err
+		}
+	}
+	if cfg.Password == "" {
+		if !interactive {
+			return fmt.Errorf("--%s is required", PasswordFlag.Name)
+		}
+		if cfg.Password, err = p.askNewPassword("Password"); err != nil {
+			return err
+		}
+	}
+
+	if vc == "" {
+		if err = client.SendCode(c.Context, server, cfg.Email); err != nil {
+			log.Printf("send verification code error: %s", err)
+			return err
+		}
+		if !interactive {
+			log.Printf("verification code sent to %s, run again with --%s", cfg.Email, VerificationCodeFlag.Name)
+			return nil
+		}
+		if vc, err = p.askRequired(fmt.Sprintf("Verification code (sent to %s)", cfg.Email)); err != nil {
+			return err
+		}
+		if ic == "" {
+			if ic, err = p.ask("Invitation code (optional)", ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = client.Register(c.Context, server, cfg.Email, cfg.Password, vc, ic); err != nil {
+		log.Printf("register error: %s", err)
+		return err
+	}
+	log.Printf("register success")
+
+	endpoint := client.New(cfg, server)
+	token, err := endpoint.Login(c.Context, true)
+	if err != nil {
+		log.Printf("Login error: %s", err)
+		return err
+	}
+	log.Printf("Login success, token expire at %s", token.ExpireAt)
+
+	if conf, err = saveConfig(c, cfg); err != nil {
+		return err
+	}
+	log.Printf("config saved to %s", conf)
+
+	if code == "" && ic == "" && interactive {
+		if code, err = p.ask("Invitation code to bind (optional)", ""); err != nil {
+			return err
+		}
+	}
+	if code != "" {
+		return bindCode(c.Context, endpoint, code, false)
+	}
+	return nil
+}
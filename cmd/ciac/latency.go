@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/latency"
+	"github.com/urfave/cli/v2"
+)
+
+var latencyCommand = &cli.Command{
+	Action: latencyReport,
+	Name:   "latency",
+	Usage:  "Report the delay between deposit and crediting per chain and symbol",
+	Description: `The delay of a deposit is its arrival time minus its recharge time.
+   Deposits without an arrival time, or with one before the recharge time,
+   are listed as pending.`,
+	Flags: []cli.Flag{
+		StartFlag,
+		EndFlag,
+		OutlierFlag,
+		HistogramFlag,
+	},
+}
+
+func latencyReport(c *cli.Context) error {
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
+	endpoint := newClient(cfg, server)
+	records, err := endpoint.AllRechargeRecords(c.Context, c.Int64(StartFlag.Name), c.Int64(EndFlag.Name))
+	if err != nil {
+		log.Printf("Get recharge records error: %s", err)
+		return err
+	}
+
+	report := latency.Analyze(records, c.Duration(OutlierFlag.Name))
+	log.Printf("chain	symbol	count	min	median	p95	max")
+	for _, g := range report.Groups {
+		log.Printf("%s	%s	%d	%s	%s	%s	%s", g.Chain, g.Symbol, g.Count, g.Min, g.Median, g.P95, g.Max)
+	}
+	for _, g := range report.Groups {
+		for _, o := range g.Outliers {
+			r := o.Record
+			log.Printf("outlier	%s %s	%f	%s	credited after %s (threshold %s)", r.Chain, r.Symbol, r.Amount,
+				time.Unix(r.RechargeTime/1000, 0).Format("2006-01-02 15:04:05"), o.Delay, g.Threshold)
+		}
+	}
+	for _, r := range report.Pending {
+		log.Printf("pending	%s %s	%f	%s	from %s", r.Chain, r.Symbol, r.Amount,
+			time.Unix(r.RechargeTime/1000, 0).Format("2006-01-02 15:04:05"), r.RechargeFrom)
+	}
+	if c.Bool(HistogramFlag.Name) {
+		for _, g := range report.Groups {
+			printHistogram(g)
+		}
+	}
+	return nil
+}
+
+func printHistogram(g latency.Stats) {
+	buckets := latency.Histogram(g.Delays, latency.DefaultBuckets)
+	max := 0
+	for _, b := range buckets {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+	fmt.Printf("%s %s\n", g.Chain, g.Symbol)
+	for _, b := range buckets {
+		label := "> " + latency.DefaultBuckets[len(latency.DefaultBuckets)-1].String()
+		if b.Upper > 0 {
+			label = "<= " + b.Upper.String()
+		}
+		width := 0
+		if max > 0 {
+			width = b.Count * chartWidth / max
+		}
+		fmt.Printf("%10s |%s %d\n", label, strings.Repeat("#", width), b.Count)
+	}
+}
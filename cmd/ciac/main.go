@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/client/cassette"
 	"github.com/urfave/cli/v2"
 	"os"
 	"os/signal"
@@ -21,19 +23,83 @@ func init() {
 
 	app.Commands = []*cli.Command{
 		timestampCommand,
+		initCommand,
 		sendCodeCommand,
 		registerCommand,
 		loginCommand,
 		userCommand,
+		statusCommand,
 		invitedCommand,
+		referralsCommand,
 		rechargedCommand,
+		exportCommand,
+		reportCommand,
+		reconcileCommand,
+		latencyCommand,
 		bindCommand,
 		addressCommand,
+		passwordCommand,
+		configCommand,
+		completionCommand,
+		shellCommand,
+		tuiCommand,
+		exporterCommand,
+		batchCommand,
+		serveCommand,
+		pluginCommand,
+		manCommand,
 	}
 	app.Flags = []cli.Flag{
 		ConfigFlag,
 		ServerFlag,
+		ProfileFlag,
+		EnvFlag,
+		RecordFlag,
+		ReplayFlag,
+		StrictFlag,
+		AddressBookFlag,
+		ConcurrencyFlag,
+		OutputFlag,
+		PluginStdinFlag,
 	}
+	app.Before = setup
+	setupPlugins(app)
+	setupCompletion(app)
+}
+
+func setup(c *cli.Context) error {
+	strictDecoding = c.Bool(StrictFlag.Name)
+	client.SetStrictDecoding(strictDecoding)
+	if concurrency = c.Int(ConcurrencyFlag.Name); concurrency < 1 {
+		return fmt.Errorf("--%s must be at least 1", ConcurrencyFlag.Name)
+	}
+	output = c.String(OutputFlag.Name)
+	if err := checkOutput(output); err != nil {
+		return err
+	}
+	return setupTransport(c)
+}
+
+// setupTransport installs the cassette recorder or replayer if requested.
+func setupTransport(c *cli.Context) error {
+	record, replay := c.String(RecordFlag.Name), c.String(ReplayFlag.Name)
+	switch {
+	case record != "" && replay != "":
+		return fmt.Errorf("--%s and --%s can not be used together", RecordFlag.Name, ReplayFlag.Name)
+	case record != "":
+		recorder, err := cassette.NewRecorder(record, nil)
+		if err != nil {
+			return err
+		}
+		client.SetTransport(recorder)
+	case replay != "":
+		replayer, err := cassette.NewReplayer(replay)
+		if err != nil {
+			return err
+		}
+		client.SetTransport(replayer)
+	}
+	return nil
 }
 
 func main() {
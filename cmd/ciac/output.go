@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// outputs are the formats of --output, text is the log output of each command.
+var outputs = []string{"text", "json", "yaml"}
+
+// output is set by --output for all commands of the process.
+var output = "text"
+
+func checkOutput(format string) error {
+	for _, o := range outputs {
+		if o == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown --%s %q, valid are %s", OutputFlag.Name, format, strings.Join(outputs, ", "))
+}
+
+// printResult writes v to the app's writer in the --output format. For text
+// the command's own log output is kept, text is called instead.
+func printResult(c *cli.Context, v interface{}, text func()) error {
+	if output == "text" {
+		text()
+		return nil
+	}
+	return writeDocument(c.App.Writer, v, output)
+}
+
+// writeDocument writes v as json or yaml.
+func writeDocument(w io.Writer, v interface{}, format string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if format != "yaml" {
+		_, err := buf.WriteTo(w)
+		return err
+	}
+	// JSON is YAML, parsing it as a node keeps the field order
+	var node yaml.Node
+	if err := yaml.Unmarshal(buf.Bytes(), &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// blockStyle drops the flow style and quotes of the JSON syntax, the encoder
+// still quotes strings that would read as another type.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
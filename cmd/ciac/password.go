@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+var passwordCommand = &cli.Command{
+	Name:  "password",
+	Usage: "Change or reset the account password (unconfirmed API, needs --unconfirmed-api)",
+	Description: `The /changePassword and /resetPassword endpoints and their newPwd field are
+   not confirmed against the server API and no interaction with them was
+   recorded. The commands refuse to run without --unconfirmed-api.`,
+	Subcommands: []*cli.Command{
+		{
+			Action: changePassword,
+			Name:   "change",
+			Usage:  "Change the password of the configured account",
+			Flags: []cli.Flag{
+				NewPasswordFlag,
+				NonInteractiveFlag,
+				UnconfirmedAPIFlag,
+			},
+		},
+		{
+			Action: resetPassword,
+			Name:   "reset",
+			Usage:  "Reset a forgotten password with a verification code",
+			Flags: []cli.Flag{
+				EmailFlag,
+				VerificationCodeFlag,
+				NewPasswordFlag,
+				NonInteractiveFlag,
+				UnconfirmedAPIFlag,
+			},
+		},
+	},
+}
+
+// requireUnconfirmedAPI refuses to call the unconfirmed password endpoints
+// unless asked to.
+func requireUnconfirmedAPI(c *cli.Context) error {
+	if !c.Bool(UnconfirmedAPIFlag.Name) {
+		return fmt.Errorf("the password endpoints are not confirmed against the server API, use --%s to try them anyway", UnconfirmedAPIFlag.Name)
+	}
+	return nil
+}
+
+func newPassword(c *cli.Context, p *prompter) (string, error) {
+	if password := c.String(NewPasswordFlag.Name); password != "" {
+		return password, nil
+	}
+	if c.Bool(NonInteractiveFlag.Name) {
+		return "", fmt.Errorf("--%s is required", NewPasswordFlag.Name)
+	}
+	return p.askNewPassword("New password")
+}
+
+// changePassword changes the password on the server, then stores it where the
+// old one came from and drops the cached token.
+func changePassword(c *cli.Context) error {
+	if err := requireUnconfirmedAPI(c); err != nil {
+		return err
+	}
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
+
+	password, err := newPassword(c, newPrompter())
+	if err != nil {
+		return err
+	}
+	endpoint := newClient(cfg, server)
+	if err = endpoint.ChangePassword(c.Context, password); err != nil {
+		log.Printf("change password error: %s", err)
+		return err
+	}
+	log.Println("password changed")
+	return storePassword(c, password)
+}
+
+// resetPassword sends a verification code (unless --vc is given), resets the
+// password, then updates the stored one if it belongs to the same account.
+func resetPassword(c *cli.Context) error {
+	if err := requireUnconfirmedAPI(c); err != nil {
+		return err
+	}
+	layers, err := configLayers(c, true)
+	if err != nil {
+		return err
+	}
+	s, err := config.Merge(layers...).Settings()
+	if err != nil {
+		return err
+	}
+	server := s.Server
+	log.Printf("Server is %s", server)
+	interactive := !c.Bool(NonInteractiveFlag.Name)
+	p := newPrompter()
+
+	email := s.Email
+	if email == "" {
+		return fmt.Errorf("no email specified, use --%s, CIAC_EMAIL or a config file", EmailFlag.Name)
+	}
+	log.Printf("Email is %s", email)
+
+	vc := c.String(VerificationCodeFlag.Name)
+	if vc == "" {
+		if err = client.SendCode(c.Context, server, email); err != nil {
+			log.Printf("send verification code error: %s", err)
+			return err
+		}
+		if !interactive {
+			log.Printf("verification code sent to %s, run again with --%s", email, VerificationCodeFlag.Name)
+			return nil
+		}
+		if vc, err = p.askRequired(fmt.Sprintf("Verification code (sent to %s)", email)); err != nil {
+			return err
+		}
+	}
+	password, err := newPassword(c, p)
+	if err != nil {
+		return err
+	}
+	if err = client.ResetPassword(c.Context, server, email, vc, password); err != nil {
+		log.Printf("reset password error: %s", err)
+		return err
+	}
+	log.Println("password reset")
+
+	if s.Password == "" {
+		return nil
+	}
+	if err = newClient(s.Config, server).Logout(); err != nil {
+		return err
+	}
+	return storePassword(c, password)
+}
+
+// storePassword writes the new password into the config file the current one
+// came from, into the profile section for a profile. Passwords from the
+// environment or flags can not be updated.
+func storePassword(c *cli.Context, password string) error {
+	layers, err := configLayers(c, true)
+	if err != nil {
+		return err
+	}
+	origin, err := config.Merge(layers...).Origin("password")
+	if err != nil {
+		return err
+	}
+	if origin.File == "" {
+		log.Printf("the password is not stored in a config file (from %q), update it yourself", origin.Source)
+		return nil
+	}
+	values := map[string]string{"password": password}
+	if origin.Profile != "" {
+		err = config.WriteProfile(origin.File, origin.Profile, values)
+	} else {
+		err = config.Write(origin.File, values)
+	}
+	if err != nil {
+		log.Printf("save config %s error: %s", origin.File, err)
+		return err
+	}
+	log.Printf("config %s updated", origin.File)
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/caitan-app/ciac/internal/config"
+	"github.com/caitan-app/ciac/plugins"
+	"github.com/urfave/cli/v2"
+)
+
+// minTokenLife is the validity a plugin can count on, a token expiring
+// sooner is renewed before the plugin starts.
+const minTokenLife = 5 * time.Minute
+
+// builtin is what shadows a plugin named like a ciac command
+const builtin = "built-in command"
+
+var pluginCommand = &cli.Command{
+	Name:  "plugin",
+	Usage: "Manage plugins, executables named " + plugins.Prefix + "<name> on PATH run as commands",
+	Description: `"ciac <name> args..." runs ` + plugins.Prefix + `<name> args... with the effective
+   configuration of the active profile in CIAC_PLUGIN_SERVER, CIAC_PLUGIN_EMAIL,
+   ..., the profile in CIAC_PLUGIN_PROFILE and a token valid for at least
+   ` + minTokenLife.String() + ` in CIAC_PLUGIN_TOKEN. With --plugin-stdin the same is written
+   to the plugin's stdin as JSON. Passwords are never passed. CIAC_CONFIG,
+   CIAC_PROFILE and CIAC_ENV are set too, so ciac run by a plugin uses the
+   same account. Plugins are looked up on PATH when run and are not listed in
+   the help, "ciac plugin list" shows them.`,
+	Subcommands: []*cli.Command{
+		{
+			Action: pluginList,
+			Name:   "list",
+			Usage:  "List the plugins found on PATH",
+		},
+	},
+}
+
+// setupPlugins runs a plugin for a name which is not a command, PATH is only
+// searched then.
+func setupPlugins(app *cli.App) {
+	app.Action = func(c *cli.Context) error {
+		if !c.Args().Present() {
+			return cli.ShowAppHelp(c)
+		}
+		name := c.Args().First()
+		p, ok := plugins.Lookup(name, os.Getenv("PATH"))
+		if !ok {
+			return fmt.Errorf("unknown command %q, see %s help", name, c.App.Name)
+		}
+		return runPlugin(c, p, c.Args().Tail())
+	}
+}
+
+func pluginList(c *cli.Context) error {
+	list := plugins.Find(os.Getenv("PATH"))
+	for i, p := range list {
+		if p.ShadowedBy == "" && app.Command(p.Name) != nil {
+			list[i].ShadowedBy = builtin
+		}
+	}
+	if list == nil {
+		list = []plugins.Plugin{}
+	}
+	return printResult(c, list, func() {
+		if len(list) == 0 {
+			log.Printf("no %s* executables on PATH", plugins.Prefix)
+		}
+		for _, p := range list {
+			if p.ShadowedBy != "" {
+				log.Printf("%s	%s	(shadowed by %s)", p.Name, p.Path, p.ShadowedBy)
+			} else {
+				log.Printf("%s	%s", p.Name, p.Path)
+			}
+		}
+	})
+}
+
+// pluginToken logs in to get a token for the plugin, plugins not needing
+// one still run when that fails.
+func pluginToken(ctx context.Context, s config.Settings) (string, time.Time) {
+	if s.Email == "" {
+		return "", time.Time{}
+	}
+	endpoint := newClient(s.Config, s.Server)
+	token, err := endpoint.Login(ctx, false)
+	if err == nil && time.Until(token.ExpireAt) < minTokenLife {
+		token, err = endpoint.Login(ctx, true)
+	}
+	if err != nil {
+		log.Printf("login failed, running the plugin without token: %s", err)
+		return "", time.Time{}
+	}
+	return token.JWT, token.ExpireAt
+}
+
+func runPlugin(c *cli.Context, p plugins.Plugin, args []string) error {
+	profile := c.String(ProfileFlag.Name)
+	layers, err := profileLayers(c, profile, false)
+	if err != nil {
+		return err
+	}
+	cfg := config.Merge(layers...)
+	s, err := cfg.Settings()
+	if err != nil {
+		return err
+	}
+	ctx := plugins.NewContext(p.Name, profile, cfg)
+	ctx.Token, ctx.ExpireAt = pluginToken(c.Context, s)
+
+	var env []string
+	for _, f := range []*cli.StringFlag{ConfigFlag, ProfileFlag, EnvFlag} {
+		if c.IsSet(f.Name) {
+			env = append(env, f.EnvVars[0]+"="+c.String(f.Name))
+		}
+	}
+	cmd, err := p.Command(args, env, ctx, c.Bool(PluginStdinFlag.Name))
+	if err != nil {
+		return err
+	}
+	err = cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		// the plugin printed why it failed
+		return cli.Exit("", exitCode(exit))
+	}
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// exitCode is the exit code of a plugin, 128+n for one killed by signal n
+// like shells report it.
+func exitCode(exit *exec.ExitError) int {
+	if status, ok := exit.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	if code := exit.ExitCode(); code > 0 {
+		return code
+	}
+	return 1
+}
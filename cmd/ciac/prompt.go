@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// prompter reads answers from stdin, prompts are written to stderr so that
+// stdout stays clean for scripts.
+type prompter struct {
+	in *bufio.Reader
+}
+
+func newPrompter() *prompter {
+	return &prompter{in: bufio.NewReader(os.Stdin)}
+}
+
+// ask prints the question and returns the trimmed answer, or def if the answer is empty.
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// askRequired keeps asking until a non-empty answer is given.
+func (p *prompter) askRequired(question string) (string, error) {
+	for {
+		answer, err := p.ask(question, "")
+		if err != nil {
+			return "", err
+		}
+		if answer != "" {
+			return answer, nil
+		}
+	}
+}
+
+// askPassword reads a password without echo when stdin is a terminal.
+func (p *prompter) askPassword(question string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return p.askRequired(question)
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "%s: ", question)
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if len(b) > 0 {
+			return string(b), nil
+		}
+	}
+}
+
+// askNewPassword asks for a password twice and checks that both match.
+func (p *prompter) askNewPassword(question string) (string, error) {
+	password, err := p.askPassword(question)
+	if err != nil {
+		return "", err
+	}
+	again, err := p.askPassword("Repeat password")
+	if err != nil {
+		return "", err
+	}
+	if password != again {
+		return "", errors.New("passwords do not match")
+	}
+	return password, nil
+}
+
+// confirm asks a yes/no question, the default answer is no.
+func (p *prompter) confirm(question string) (bool, error) {
+	answer, err := p.ask(question+" (y/N)", "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/reconcile"
+	"github.com/urfave/cli/v2"
+)
+
+// exit code of reconcile when some deposits or transfers did not match
+const reconcileMismatch = 2
+
+var reconcileCommand = &cli.Command{
+	Action: reconcileDeposits,
+	Name:   "reconcile",
+	Usage:  "Match deposits credited by the server with transfers on chain",
+	Description: `Transfers to addresses other than our recharge addresses are ignored.
+   --start and --end are Unix milliseconds and apply to the chain file too.
+   The exit code is 0 if everything matched, 2 if not and 1 on errors.`,
+	Flags: []cli.Flag{
+		ChainFileFlag,
+		WindowFlag,
+		ToleranceFlag,
+		StartFlag,
+		EndFlag,
+	},
+}
+
+func reconcileDeposits(c *cli.Context) error {
+	f, err := os.Open(c.String(ChainFileFlag.Name))
+	if err != nil {
+		return err
+	}
+	transfers, err := reconcile.ReadTransfers(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("read %s: %w", c.String(ChainFileFlag.Name), err)
+	}
+
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
+	endpoint := newClient(cfg, server)
+	records, err := endpoint.AllRechargeRecords(c.Context, c.Int64(StartFlag.Name), c.Int64(EndFlag.Name))
+	if err != nil {
+		log.Printf("Get recharge records error: %s", err)
+		return err
+	}
+
+	// our addresses are the current ones and all that were ever credited
+	addresses := make(map[string]bool)
+	for _, r := range endpoint.Addresses(c.Context, client.ValidPairs, false) {
+		if r.Err != nil {
+			// without the address its transfers would silently be ignored
+			log.Printf("Get recharge address error: %s", r.Err)
+			return r.Err
+		}
+		if r.Address != "" {
+			addresses[r.Address] = true
+			recordAddress(c, c.String(ProfileFlag.Name), endpoint, r.AddressEntry, false)
+		}
+	}
+	for _, r := range records {
+		addresses[r.RechargeTo] = true
+	}
+
+	result := reconcile.Reconcile(records, transfers, reconcile.Options{
+		Window:    c.Duration(WindowFlag.Name),
+		Tolerance: c.Float64(ToleranceFlag.Name),
+		Addresses: addresses,
+		Start:     millisTime(c.Int64(StartFlag.Name)),
+		End:       millisTime(c.Int64(EndFlag.Name)),
+	})
+	printMatches("matched", result.Matched)
+	printMatches("amount mismatch", result.Mismatched)
+	for _, r := range result.ServerOnly {
+		log.Printf("unmatched on server	%s	%f %s	to %s", recordTimeString(r), r.Amount, r.Symbol, r.RechargeTo)
+	}
+	for _, t := range result.ChainOnly {
+		log.Printf("unmatched on chain	%s	%f %s	to %s	tx %s", t.Time.Local().Format("2006-01-02 15:04:05"), t.Amount, t.Symbol, t.To, t.Hash)
+	}
+	log.Printf("%d matched, %d amount mismatches, %d unmatched on server, %d unmatched on chain",
+		len(result.Matched), len(result.Mismatched), len(result.ServerOnly), len(result.ChainOnly))
+	if !result.OK() {
+		return cli.Exit("reconciliation failed", reconcileMismatch)
+	}
+	return nil
+}
+
+// millisTime converts a --start or --end value, 0 is the zero time.
+func millisTime(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+}
+
+func recordTimeString(r client.RechargeRecord) string {
+	return time.Unix(r.RechargeTime/1000, 0).Format("2006-01-02 15:04:05")
+}
+
+func printMatches(kind string, matches []reconcile.Match) {
+	for _, m := range matches {
+		log.Printf("%s	%s	%f %s	to %s	tx %s (%f)", kind, recordTimeString(m.Record),
+			m.Record.Amount, m.Record.Symbol, m.Record.RechargeTo, m.Transfer.Hash, m.Transfer.Amount)
+	}
+}
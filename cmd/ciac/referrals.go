@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/urfave/cli/v2"
+)
+
+var referralsCommand = &cli.Command{
+	Action: referrals,
+	Name:   "referrals",
+	Usage:  "Show invitation code, invited users and rewards",
+	Flags: []cli.Flag{
+		StartFlag,
+		EndFlag,
+		InviteLinkFlag,
+		ChartFlag,
+	},
+}
+
+type rewardKey struct {
+	rewardType, rewardUnit int
+}
+
+type rewardSum struct {
+	count  int
+	number int
+}
+
+// referralSummary aggregates invitation records for the dashboard.
+type referralSummary struct {
+	invited  int
+	rewards  map[rewardKey]*rewardSum
+	timeline map[string]int // day => number of rewards
+}
+
+func summarizeReferrals(records []client.InvitationRecord) referralSummary {
+	s := referralSummary{
+		rewards:  make(map[rewardKey]*rewardSum),
+		timeline: make(map[string]int),
+	}
+	users := make(map[string]bool)
+	for _, r := range records {
+		users[r.NickName] = true
+		k := rewardKey{r.RewardType, r.RewardUnit}
+		if s.rewards[k] == nil {
+			s.rewards[k] = &rewardSum{}
+		}
+		s.rewards[k].count++
+		s.rewards[k].number += r.RewardNumber
+		day := time.Unix(r.RewardTime/1000, 0).Format("2006-01-02")
+		s.timeline[day]++
+	}
+	s.invited = len(users)
+	return s
+}
+
+// inviteLink fills the invitation code into link, a link without {code} gets
+// it as the invitationCode query parameter.
+func inviteLink(link, code string) (string, error) {
+	if strings.Contains(link, "{code}") {
+		return strings.ReplaceAll(link, "{code}", url.QueryEscape(code)), nil
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("invitationCode", code)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// referrals shows the invitation dashboard of the configured account.
+func referrals(c *cli.Context) error {
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
+	endpoint := newClient(cfg, server)
+
+	profile, err := endpoint.UserInfo(c.Context)
+	if err != nil {
+		log.Printf("get user info error: %s", err)
+		return err
+	}
+	records, err := endpoint.AllInvitationRecords(c.Context, c.Int64(StartFlag.Name), c.Int64(EndFlag.Name))
+	if err != nil {
+		log.Printf("Get invitation records error: %s", err)
+		return err
+	}
+	link := c.String(InviteLinkFlag.Name)
+	if link == "" {
+		link = s.InviteLink
+	}
+	summary := summarizeReferrals(records)
+
+	fmt.Printf("Invitation code: %s\n", profile.Code)
+	if link != "" {
+		if link, err = inviteLink(link, profile.Code); err != nil {
+			return err
+		}
+		fmt.Printf("Invite link:     %s\n", link)
+	} else {
+		log.Printf("no invite link, set the inviteLink config key or --%s", InviteLinkFlag.Name)
+	}
+	fmt.Printf("Invited users:   %d\n", summary.invited)
+	fmt.Printf("Rewards:         %d\n", len(records))
+
+	fmt.Println()
+	fmt.Println("rewardType\trewardUnit\tcount\ttotal")
+	keys := make([]rewardKey, 0, len(summary.rewards))
+	for k := range summary.rewards {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].rewardType != keys[j].rewardType {
+			return keys[i].rewardType < keys[j].rewardType
+		}
+		return keys[i].rewardUnit < keys[j].rewardUnit
+	})
+	for _, k := range keys {
+		fmt.Printf("%d\t%d\t%d\t%d\n", k.rewardType, k.rewardUnit, summary.rewards[k].count, summary.rewards[k].number)
+	}
+
+	fmt.Println()
+	printTimeline(summary.timeline, c.Bool(ChartFlag.Name))
+	return nil
+}
+
+// chartWidth is the length of the longest bar in the ASCII chart.
+const chartWidth = 50
+
+func printTimeline(timeline map[string]int, chart bool) {
+	days := make([]string, 0, len(timeline))
+	max := 0
+	for day, n := range timeline {
+		days = append(days, day)
+		if n > max {
+			max = n
+		}
+	}
+	sort.Strings(days)
+	for _, day := range days {
+		n := timeline[day]
+		if !chart {
+			fmt.Printf("%s\t%d\n", day, n)
+			continue
+		}
+		width := n * chartWidth / max
+		if width == 0 {
+			width = 1
+		}
+		fmt.Printf("%s |%s %d\n", day, strings.Repeat("#", width), n)
+	}
+}
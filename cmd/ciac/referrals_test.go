@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+func TestSummarizeReferrals(t *testing.T) {
+	day := func(d int) int64 {
+		return time.Date(2021, 8, d, 12, 0, 0, 0, time.Local).UnixNano() / 1e6
+	}
+	s := summarizeReferrals([]client.InvitationRecord{
+		{NickName: "alice", RewardType: 1, RewardNumber: 7, RewardUnit: 1, RewardTime: day(1)},
+		{NickName: "alice", RewardType: 1, RewardNumber: 3, RewardUnit: 1, RewardTime: day(1)},
+		{NickName: "bob", RewardType: 2, RewardNumber: 5, RewardUnit: 1, RewardTime: day(3)},
+	})
+	if s.invited != 2 {
+		t.Errorf("invited = %d, want 2", s.invited)
+	}
+	if r := s.rewards[rewardKey{1, 1}]; r == nil || r.count != 2 || r.number != 10 {
+		t.Errorf("rewards 1/1 = %+v", r)
+	}
+	if r := s.rewards[rewardKey{2, 1}]; r == nil || r.count != 1 || r.number != 5 {
+		t.Errorf("rewards 2/1 = %+v", r)
+	}
+	if len(s.timeline) != 2 || s.timeline["2021-08-01"] != 2 || s.timeline["2021-08-03"] != 1 {
+		t.Errorf("timeline = %v", s.timeline)
+	}
+	if s := summarizeReferrals(nil); s.invited != 0 || len(s.rewards) != 0 {
+		t.Errorf("empty summary = %+v", s)
+	}
+}
+
+func TestInviteLink(t *testing.T) {
+	for _, tt := range []struct{ link, want string }{
+		{"https://caitan.app/join/{code}", "https://caitan.app/join/AB12cd"},
+		{"https://caitan.app/signup?ref={code}", "https://caitan.app/signup?ref=AB12cd"},
+		{"https://caitan.app/register", "https://caitan.app/register?invitationCode=AB12cd"},
+	} {
+		got, err := inviteLink(tt.link, "AB12cd")
+		if err != nil || got != tt.want {
+			t.Errorf("inviteLink(%q) = %q, %v, want %q", tt.link, got, err, tt.want)
+		}
+	}
+}
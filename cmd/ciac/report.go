@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/valuation"
+	"github.com/urfave/cli/v2"
+)
+
+var reportCommand = &cli.Command{
+	Action: report,
+	Name:   "report",
+	Usage:  "Value deposits in fiat from a historical price table",
+	Description: `The price of a deposit is the last price of its symbol at or before
+   the recharge time. The table has the columns time, symbol, price and an
+   optional fiat, a row without fiat is valid for any fiat.`,
+	Flags: []cli.Flag{
+		FiatFlag,
+		PricesFlag,
+		PeriodFlag,
+		StartFlag,
+		EndFlag,
+	},
+}
+
+func report(c *cli.Context) error {
+	table, err := valuation.LoadTable(c.String(PricesFlag.Name))
+	if err != nil {
+		return fmt.Errorf("load prices: %w", err)
+	}
+	fiat := strings.ToUpper(c.String(FiatFlag.Name))
+	period := c.String(PeriodFlag.Name)
+	if _, err = valuation.PeriodOf(period, time.Time{}); err != nil {
+		return err
+	}
+
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
+	endpoint := newClient(cfg, server)
+	records, err := endpoint.AllRechargeRecords(c.Context, c.Int64(StartFlag.Name), c.Int64(EndFlag.Name))
+	if err != nil {
+		log.Printf("Get recharge records error: %s", err)
+		return err
+	}
+
+	deposits := valuation.Value(records, table, fiat)
+	log.Printf("time	chain	amount	symbol	price	value(%s)", fiat)
+	for _, d := range deposits {
+		if d.Err != nil {
+			log.Printf("%s	%s	%f	%s	-	- (%s)", d.Time.Format("2006-01-02 15:04:05"), d.Chain, d.Amount, d.Symbol, d.Err)
+			continue
+		}
+		log.Printf("%s	%s	%f	%s	%.4f	%.2f", d.Time.Format("2006-01-02 15:04:05"), d.Chain, d.Amount, d.Symbol, d.Price, d.Value)
+	}
+
+	totals, err := valuation.Totals(deposits, period)
+	if err != nil {
+		return err
+	}
+	var sum float64
+	unpriced := 0
+	log.Printf("%s	deposits	value(%s)	by symbol", period, fiat)
+	for _, t := range totals {
+		symbols := make([]string, 0, len(t.BySymbol))
+		for symbol, v := range t.BySymbol {
+			symbols = append(symbols, fmt.Sprintf("%s %.2f", symbol, v))
+		}
+		sort.Strings(symbols)
+		log.Printf("%s	%d	%.2f	%s", t.Period, t.Count, t.Value, strings.Join(symbols, ", "))
+		sum += t.Value
+		unpriced += t.Unpriced
+	}
+	log.Printf("total	%d	%.2f", len(deposits), sum)
+	if unpriced > 0 {
+		log.Printf("warning: %d deposit(s) without a price are not part of the totals", unpriced)
+	}
+	return nil
+}
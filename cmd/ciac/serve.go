@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/gateway"
+	"github.com/urfave/cli/v2"
+)
+
+var serveCommand = &cli.Command{
+	Action: serve,
+	Name:   "serve",
+	Usage:  "Serve the client operations as a local JSON API",
+	Description: `Tools pass ?account=<profile> to use a profile, the API is described
+   at /openapi.json. Login and token refresh are done by the daemon.`,
+	Flags: []cli.Flag{
+		ServeListenFlag,
+		APIKeyFlag,
+		APIKeyFileFlag,
+	},
+}
+
+// apiKey returns the key given by --api-key, or the one stored in the key
+// file, which is created with a random key readable by the owner only. An
+// empty key is an error, it would let requests without a key through.
+func apiKey(c *cli.Context) (string, error) {
+	if c.IsSet(APIKeyFlag.Name) {
+		key := strings.TrimSpace(c.String(APIKeyFlag.Name))
+		if key == "" {
+			return "", fmt.Errorf("--%s is empty", APIKeyFlag.Name)
+		}
+		return key, nil
+	}
+	filename := c.String(APIKeyFileFlag.Name)
+	if filename == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		filename = filepath.Join(dir, "ciac", "gateway.key")
+	}
+	b, err := os.ReadFile(filename)
+	if err == nil {
+		key := strings.TrimSpace(string(b))
+		if key == "" {
+			return "", fmt.Errorf("API key file %s is empty", filename)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(buf)
+	if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(filename, []byte(key+"\n"), 0600); err != nil {
+		return "", err
+	}
+	log.Printf("API key written to %s", filename)
+	return key, nil
+}
+
+// listen opens a TCP address or, with the unix: prefix, a Unix socket
+// accessible by the owner only. A stale socket is removed, any other file at
+// the path is left alone.
+func listen(address string) (net.Listener, error) {
+	path := strings.TrimPrefix(address, "unix:")
+	if path == address {
+		return net.Listen("tcp", address)
+	}
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil && info.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("%s exists and is not a socket", path)
+	case err == nil:
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func serve(c *cli.Context) error {
+	key, err := apiKey(c)
+	if err != nil {
+		return err
+	}
+	// fail early on a broken configuration rather than on the first request
+	if _, err = loadConfig(c); err != nil {
+		return err
+	}
+	g := gateway.New(key, func(account string) (*client.Client, error) {
+		if account == "" {
+			account = c.String(ProfileFlag.Name)
+		}
+		s, err := loadProfile(c, account)
+		if err != nil {
+			return nil, err
+		}
+		return newClient(s.Config, s.Server), nil
+	})
+
+	l, err := listen(c.String(ServeListenFlag.Name))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(c.Context)
+	defer cancel()
+	server := &http.Server{Handler: g}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	log.Printf("serving on %s", c.String(ServeListenFlag.Name))
+	if err = server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/peterh/liner"
+	"github.com/urfave/cli/v2"
+)
+
+var shellCommand = &cli.Command{
+	Action: shell,
+	Name:   "shell",
+	Usage:  "Interactive prompt keeping the session open between commands",
+	Description: `Runs ciac commands typed at the prompt, the logged in clients are kept in
+memory. Besides the ciac commands the shell knows:
+
+   set <name> <value>   set a session variable: profile, env, start or end
+   unset <name>         remove a session variable
+   vars                 print the session variables
+   history              print the command history
+   exit, quit           leave the shell
+
+start and end take a date (2006-01-02), a time (RFC 3339), a duration before
+now (24h) or milliseconds since the epoch, and are passed to every command
+that has --start/--end.`,
+}
+
+// session holds the variables of a shell session.
+type session struct {
+	vars map[string]string
+	// defaults of the slice flags, restored before each line
+	defaults map[*cli.StringSliceFlag][]string
+}
+
+var sessionVars = []string{"profile", "env", "start", "end"}
+
+// parseTimeArg converts a date, an RFC 3339 time, a duration before now or
+// milliseconds since the epoch to milliseconds since the epoch.
+func parseTimeArg(s string, now time.Time) (int64, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ms, nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "-")); err == nil {
+		return now.Add(-d).UnixNano() / 1e6, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UnixNano() / 1e6, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t.UnixNano() / 1e6, nil
+	}
+	return 0, fmt.Errorf("bad time %q", s)
+}
+
+// splitLine splits a command line into words, honouring single and double quotes.
+func splitLine(line string) ([]string, error) {
+	var (
+		words []string
+		word  strings.Builder
+		quote rune
+		in    bool
+	)
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, in = r, true
+		case unicode.IsSpace(r):
+			if in {
+				words = append(words, word.String())
+				word.Reset()
+				in = false
+			}
+		default:
+			word.WriteRune(r)
+			in = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if in {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// hasFlag tells if a command (or one of its subcommands) accepts the flag.
+func hasFlag(cmd *cli.Command, name string) bool {
+	for _, f := range cmd.Flags {
+		for _, n := range f.Names() {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globalArgs returns the global flags the shell was started with, except the
+// ones the session handles itself: profile and env can be overridden by the
+// session variables, and the transport of --record/--replay is installed once
+// for the whole session, a new one per line would start the cassette over.
+func globalArgs(c *cli.Context) []string {
+	var args []string
+	for _, f := range c.App.Flags {
+		name := f.Names()[0]
+		switch name {
+		case ProfileFlag.Name, EnvFlag.Name, RecordFlag.Name, ReplayFlag.Name:
+			continue
+		}
+		if !c.IsSet(name) {
+			continue
+		}
+		if _, ok := f.(*cli.StringSliceFlag); ok {
+			for _, v := range c.StringSlice(name) {
+				args = append(args, "--"+name+"="+v)
+			}
+			continue
+		}
+		if v, ok := c.Generic(name).(flag.Value); ok {
+			args = append(args, "--"+name+"="+v.String())
+		}
+	}
+	return args
+}
+
+// expand builds the arguments of one run of the app: the global flags of the
+// shell, the session variables, then the words typed.
+func (s *session) expand(c *cli.Context, words []string) ([]string, error) {
+	args := append([]string{c.App.Name}, globalArgs(c)...)
+	if v, ok := s.vars["profile"]; ok {
+		args = append(args, "--"+ProfileFlag.Name, v)
+	} else if c.IsSet(ProfileFlag.Name) {
+		args = append(args, "--"+ProfileFlag.Name, c.String(ProfileFlag.Name))
+	}
+	if v, ok := s.vars["env"]; ok {
+		args = append(args, "--"+EnvFlag.Name, v)
+	} else if c.IsSet(EnvFlag.Name) {
+		args = append(args, "--"+EnvFlag.Name, c.String(EnvFlag.Name))
+	}
+
+	cmd := c.App.Command(words[0])
+	args = append(args, words[0])
+	if cmd == nil {
+		return append(args, words[1:]...), nil
+	}
+	typed := strings.Join(words[1:], " ")
+	for _, name := range []string{StartFlag.Name, EndFlag.Name} {
+		v, ok := s.vars[name]
+		if !ok || !hasFlag(cmd, name) || strings.Contains(typed, "--"+name) {
+			continue
+		}
+		ms, err := parseTimeArg(v, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--"+name, strconv.FormatInt(ms, 10))
+	}
+	return append(args, words[1:]...), nil
+}
+
+// builtin runs the shell's own commands, done is false if words is not one.
+func (s *session) builtin(words []string, line *liner.State, out io.Writer) (done bool, err error) {
+	switch words[0] {
+	case "set":
+		if len(words) != 3 {
+			return true, errors.New("usage: set <name> <value>")
+		}
+		if !contains(sessionVars, words[1]) {
+			return true, fmt.Errorf("unknown variable %q, known are %s", words[1], strings.Join(sessionVars, ", "))
+		}
+		if words[1] == "start" || words[1] == "end" {
+			if _, err := parseTimeArg(words[2], time.Now()); err != nil {
+				return true, err
+			}
+		}
+		s.vars[words[1]] = words[2]
+	case "unset":
+		if len(words) != 2 {
+			return true, errors.New("usage: unset <name>")
+		}
+		delete(s.vars, words[1])
+	case "vars":
+		names := make([]string, 0, len(s.vars))
+		for name := range s.vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "%s = %s\n", name, s.vars[name])
+		}
+	case "history":
+		_, err = line.WriteHistory(out)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// sliceDefaults keeps the default of every slice flag of the app and its
+// commands. The flags keep their Value between runs of the app, so a value
+// given in one shell line would show up again in the next ones.
+func sliceDefaults(app *cli.App) map[*cli.StringSliceFlag][]string {
+	defaults := make(map[*cli.StringSliceFlag][]string)
+	add := func(flags []cli.Flag) {
+		for _, f := range flags {
+			f, ok := f.(*cli.StringSliceFlag)
+			if !ok {
+				continue
+			}
+			if _, seen := defaults[f]; seen {
+				continue
+			}
+			var v []string
+			if f.Value != nil {
+				v = f.Value.Value()
+			}
+			defaults[f] = v
+		}
+	}
+	var walk func(cmds []*cli.Command)
+	walk = func(cmds []*cli.Command) {
+		for _, cmd := range cmds {
+			add(cmd.Flags)
+			walk(cmd.Subcommands)
+		}
+	}
+	add(app.Flags)
+	walk(app.Commands)
+	return defaults
+}
+
+// resetSliceFlags gives the slice flags fresh values holding their defaults.
+func resetSliceFlags(defaults map[*cli.StringSliceFlag][]string) {
+	for f, v := range defaults {
+		f.Value = cli.NewStringSlice(v...)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func historyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ciac", "history")
+}
+
+// shell reads commands until EOF or exit, each one is run by the app itself.
+func shell(c *cli.Context) error {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+
+	var names []string
+	for _, cmd := range c.App.Commands {
+		if cmd.Name != c.Command.Name {
+			names = append(names, cmd.Name)
+		}
+	}
+	names = append(names, "set", "unset", "vars", "history", "exit", "quit")
+	line.SetCompleter(func(l string) []string {
+		var candidates []string
+		for _, name := range names {
+			if strings.HasPrefix(name, l) {
+				candidates = append(candidates, name)
+			}
+		}
+		return candidates
+	})
+
+	history := historyFile()
+	if f, err := os.Open(history); err == nil {
+		_, _ = line.ReadHistory(f)
+		f.Close()
+	}
+	defer func() {
+		if history == "" {
+			return
+		}
+		_ = os.MkdirAll(filepath.Dir(history), 0700)
+		if f, err := os.OpenFile(history, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); err == nil {
+			_, _ = line.WriteHistory(f)
+			f.Close()
+		}
+	}()
+
+	// commands must not end the shell through os.Exit, errors are printed below
+	exitHandler := c.App.ExitErrHandler
+	c.App.ExitErrHandler = func(*cli.Context, error) {}
+	defer func() { c.App.ExitErrHandler = exitHandler }()
+
+	s := &session{vars: make(map[string]string), defaults: sliceDefaults(c.App)}
+	for {
+		if c.Context.Err() != nil {
+			return nil
+		}
+		prompt := "ciac> "
+		if p, ok := s.vars["profile"]; ok {
+			prompt = fmt.Sprintf("ciac(%s)> ", p)
+		}
+		input, err := line.Prompt(prompt)
+		if errors.Is(err, io.EOF) || errors.Is(err, liner.ErrPromptAborted) {
+			fmt.Println()
+			return nil
+		} else if err != nil {
+			return err
+		}
+		words, err := splitLine(input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		line.AppendHistory(input)
+
+		switch words[0] {
+		case "exit", "quit":
+			return nil
+		case c.Command.Name:
+			fmt.Fprintln(os.Stderr, "already in the shell")
+			continue
+		}
+		if done, err := s.builtin(words, line, os.Stdout); done {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			continue
+		}
+		if err = s.run(c, words); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// run runs the app for the words of one line.
+func (s *session) run(c *cli.Context, words []string) error {
+	args, err := s.expand(c, words)
+	if err != nil {
+		return err
+	}
+	resetSliceFlags(s.defaults)
+	return c.App.RunContext(c.Context, args)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// TestShellSliceFlags runs two lines in a row, the slice flags of the first
+// one must not leak into the second.
+func TestShellSliceFlags(t *testing.T) {
+	var got [][]string
+	probe := &cli.Command{
+		Name:  "probe",
+		Flags: []cli.Flag{&cli.StringSliceFlag{Name: "pair", Value: cli.NewStringSlice("0/0")}},
+		Action: func(c *cli.Context) error {
+			got = append(got, c.StringSlice("pair"))
+			return nil
+		},
+	}
+	lines := [][]string{
+		{"probe", "--pair", "1/0", "--pair", "2/0"},
+		{"probe", "--pair", "0/2"},
+		{"probe"},
+	}
+	app := cli.NewApp()
+	app.Commands = []*cli.Command{
+		probe,
+		{
+			Name: "shell",
+			Action: func(c *cli.Context) error {
+				s := &session{vars: make(map[string]string), defaults: sliceDefaults(c.App)}
+				for _, words := range lines {
+					if err := s.run(c, words); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+	if err := app.Run([]string{"ciac", "shell"}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"1/0", "2/0"},
+		{"0/2"},
+		{"0/0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pairs = %q, want %q", got, want)
+	}
+}
+
+// TestShellGlobalFlags checks that the global flags the shell was started with
+// reach the commands run in it, except the cassette ones.
+func TestShellGlobalFlags(t *testing.T) {
+	var got []string
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		&cli.BoolFlag{Name: "strict"},
+		&cli.IntFlag{Name: "concurrency", Value: 1},
+		&cli.StringSliceFlag{Name: "plugin-dir"},
+		ReplayFlag,
+		ProfileFlag,
+	}
+	app.Commands = []*cli.Command{
+		{
+			Name: "probe",
+			Action: func(c *cli.Context) error {
+				got = []string{fmt.Sprint(c.Bool("strict")), fmt.Sprint(c.Int("concurrency")),
+					fmt.Sprint(c.StringSlice("plugin-dir")), c.String(ReplayFlag.Name), c.String(ProfileFlag.Name)}
+				return nil
+			},
+		},
+		{
+			Name: "shell",
+			Action: func(c *cli.Context) error {
+				s := &session{vars: map[string]string{"profile": "bob"}, defaults: sliceDefaults(c.App)}
+				return s.run(c, []string{"probe"})
+			},
+		},
+	}
+	args := []string{"ciac", "--strict", "--concurrency", "3", "--plugin-dir", "a", "--plugin-dir", "b",
+		"--replay", "cas", "--profile", "alice", "shell"}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"true", "3", "[a b]", "", "bob"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flags = %q, want %q", got, want)
+	}
+}
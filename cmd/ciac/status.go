@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+var statusCommand = &cli.Command{
+	Action: status,
+	Name:   "status",
+	Usage:  "Show subscription status",
+	Flags: []cli.Flag{
+		WarnFlag,
+		CheckFlag,
+	},
+}
+
+// exit codes of status --check, the same as used by nagios style checks
+const (
+	statusOK       = 0
+	statusWarning  = 1
+	statusCritical = 2
+	statusUnknown  = 3
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// subscriptionState classifies the remaining time against the warn threshold.
+func subscriptionState(remaining, warn time.Duration) (state string, code int) {
+	switch {
+	case remaining <= 0:
+		return "EXPIRED", statusCritical
+	case remaining <= warn:
+		return "EXPIRING", statusWarning
+	default:
+		return "ACTIVE", statusOK
+	}
+}
+
+func colorize(s string, code int) string {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return s
+	}
+	switch code {
+	case statusCritical:
+		return colorRed + s + colorReset
+	case statusWarning:
+		return colorYellow + s + colorReset
+	default:
+		return colorGreen + s + colorReset
+	}
+}
+
+// status prints the subscription state, with --check the exit code reflects it.
+func status(c *cli.Context) error {
+	// under --check failing to get the state is UNKNOWN, not a WARNING
+	unknown := func(err error) error {
+		if c.Bool(CheckFlag.Name) {
+			return cli.Exit(fmt.Sprintf("UNKNOWN: %s", err), statusUnknown)
+		}
+		return err
+	}
+	s, err := loadConfig(c)
+	if err != nil {
+		return unknown(err)
+	}
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
+	endpoint := newClient(cfg, server)
+
+	profile, err := endpoint.UserInfo(c.Context)
+	if err != nil {
+		log.Printf("get user info error: %s", err)
+		return unknown(err)
+	}
+	warn := c.Duration(WarnFlag.Name)
+	state, code := subscriptionState(profile.RemainingTime, warn)
+	fmt.Printf("Account:   %s\n", profile.Email)
+	fmt.Printf("Status:    %s\n", colorize(state, code))
+	fmt.Printf("Expire at: %s\n", profile.ExpireAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Remaining: %s\n", profile.RemainingTime.Truncate(time.Minute))
+
+	if c.Bool(CheckFlag.Name) && code != statusOK {
+		return cli.Exit(fmt.Sprintf("subscription of %s is %s", profile.Email, state), code)
+	}
+	return nil
+}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/exporter"
 	"github.com/urfave/cli/v2"
-	"github.com/xyths/hs"
 
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,8 +20,7 @@ var (
 		Action: timestamp,
 		Name:   "timestamp",
 		Usage:  "Get timestamp from the server",
-		Flags: []cli.Flag{
-		},
+		Flags:  []cli.Flag{},
 	}
 	sendCodeCommand = &cli.Command{
 		Action: sendCode,
@@ -30,6 +35,8 @@ var (
 		Name:   "register",
 		Usage:  "Register a new user",
 		Flags: []cli.Flag{
+			EmailFlag,
+			PasswordFlag,
 			VerificationCodeFlag,
 			InvitationCodeFlag,
 		},
@@ -46,8 +53,7 @@ var (
 		Action: user,
 		Name:   "user",
 		Usage:  "List user info",
-		Flags: []cli.Flag{
-		},
+		Flags:  []cli.Flag{},
 	}
 	invitedCommand = &cli.Command{
 		Action: invited,
@@ -58,6 +64,7 @@ var (
 			EndFlag,
 			PageFlag,
 			PageSizeFlag,
+			AllFlag,
 		},
 	}
 	rechargedCommand = &cli.Command{
@@ -69,31 +76,49 @@ var (
 			EndFlag,
 			PageFlag,
 			PageSizeFlag,
+			AllFlag,
 		},
 	}
 	bindCommand = &cli.Command{
 		Action: bind,
 		Name:   "bind",
 		Usage:  "Bind invitation code",
+		Description: `The code format and whether the account is already bound are not
+   documented, so the server is the only validator: its result and message are
+   reported as they are. Locally the code is only checked not to be your own,
+   --dry-run stops after that check.`,
 		Flags: []cli.Flag{
 			CodeFlag,
+			DryRunFlag,
 		},
 	}
 	addressCommand = &cli.Command{
-		Action: address,
-		Name:   "address",
-		Usage:  "Print recharge address",
+		Action:    address,
+		Name:      "address",
+		Usage:     "Print recharge address",
+		ArgsUsage: "[protocol [type]]",
 		Flags: []cli.Flag{
 			ProtocolFlag,
 			TypeFlag,
+			PairFlag,
 			ForceAddressFlag,
+			YesFlag,
+			DryRunFlag,
+			ProfilesFlag,
+			AllProfilesFlag,
+		},
+		Subcommands: []*cli.Command{
+			addressHistoryCommand,
 		},
 	}
 )
 
 func timestamp(c *cli.Context) error {
-	server := c.String(ServerFlag.Name)
-	t, err := client.Timestamp(server)
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	t, err := client.Timestamp(c.Context, s.Server)
 	if err != nil {
 		return err
 	}
@@ -103,50 +128,49 @@ func timestamp(c *cli.Context) error {
 }
 
 func sendCode(c *cli.Context) error {
-	server := c.String(ServerFlag.Name)
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	server := s.Server
 	log.Printf("Server is %s", server)
-	email := c.String(EmailFlag.Name)
+	email := s.Email
 	if email == "" {
-		conf := c.String(ConfigFlag.Name)
-		cfg, err := parseConfig(conf)
-		if err != nil {
-			log.Printf("no email specified, and has no valid config(config file is %s, got error: %s)", conf, err)
-			return err
-		}
-		email = cfg.Email
+		return fmt.Errorf("no email specified, use --%s, %s or a config file", EmailFlag.Name, "CIAC_EMAIL")
 	}
 	log.Printf("Email is %s", email)
 
-	return client.SendCode(server, email)
+	return client.SendCode(c.Context, server, email)
 }
 
 func register(c *cli.Context) error {
-	server := c.String(ServerFlag.Name)
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	server := s.Server
 	vc := c.String(VerificationCodeFlag.Name)
 	ic := c.String(InvitationCodeFlag.Name)
 	log.Printf("Server is %s", server)
-	conf := c.String(ConfigFlag.Name)
-	cfg, err := parseConfig(conf)
-	if err != nil {
-		log.Printf("no email specified, and has no valid config(config file is %s, got error: %s)", conf, err)
-		return err
+	email := s.Email
+	if email == "" || s.Password == "" {
+		return fmt.Errorf("email and password are required, use --%s/--%s, CIAC_EMAIL/CIAC_PASSWORD or a config file", EmailFlag.Name, PasswordFlag.Name)
 	}
-	email := cfg.Email
 	log.Printf("Email is %s", email)
 
-	return client.Register(server, email, cfg.Password, vc, ic)
+	return client.Register(c.Context, server, email, s.Password, vc, ic)
 }
 
 func login(c *cli.Context) error {
-	server := c.String(ServerFlag.Name)
-	log.Printf("Server is %s", server)
-	cfg, err := parseConfig(c.String(ConfigFlag.Name))
+	s, err := loadConfig(c)
 	if err != nil {
 		return err
 	}
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
 	force := c.Bool(ForceFlag.Name)
-	endpoint := client.New(cfg, server)
-	token, err := endpoint.Login(force)
+	endpoint := newClient(cfg, server)
+	token, err := endpoint.Login(c.Context, force)
 	if err != nil {
 		log.Printf("Login error: %s", err)
 		return err
@@ -157,13 +181,13 @@ func login(c *cli.Context) error {
 
 // user list user info
 func user(c *cli.Context) error {
-	server := c.String(ServerFlag.Name)
-	log.Printf("Server is %s", server)
-	cfg, err := parseConfig(c.String(ConfigFlag.Name))
+	s, err := loadConfig(c)
 	if err != nil {
 		return err
 	}
-	endpoint := client.New(cfg, server)
+	cfg, server := s.Config, s.Server
+	log.Printf("Server is %s", server)
+	endpoint := newClient(cfg, server)
 
 	profile, err := endpoint.UserInfo(c.Context)
 	if err != nil {
@@ -176,19 +200,24 @@ func user(c *cli.Context) error {
 
 // invited list invited records
 func invited(c *cli.Context) error {
-	cfg, err := parseConfig(c.String(ConfigFlag.Name))
+	s, err := loadConfig(c)
 	if err != nil {
 		return err
 	}
-	server := c.String(ServerFlag.Name)
+	cfg, server := s.Config, s.Server
 	log.Printf("Server is %s", server)
-	endpoint := client.New(cfg, server)
+	endpoint := newClient(cfg, server)
 
 	start := c.Int64(StartFlag.Name)
 	end := c.Int64(EndFlag.Name)
 	page := c.Int(PageFlag.Name)
 	pageSize := c.Int(PageSizeFlag.Name)
-	records, err := endpoint.InvitationRecords(c.Context, start, end, page, pageSize)
+	var records []client.InvitationRecord
+	if c.Bool(AllFlag.Name) {
+		records, err = endpoint.AllInvitationRecords(c.Context, start, end)
+	} else {
+		records, err = endpoint.InvitationRecords(c.Context, start, end, page, pageSize)
+	}
 	if err != nil {
 		log.Printf("Get invitation records error: %s", err)
 		return err
@@ -203,19 +232,24 @@ func invited(c *cli.Context) error {
 
 // recharged list recharged records
 func recharged(c *cli.Context) error {
-	cfg, err := parseConfig(c.String(ConfigFlag.Name))
+	s, err := loadConfig(c)
 	if err != nil {
 		return err
 	}
-	server := c.String(ServerFlag.Name)
+	cfg, server := s.Config, s.Server
 	log.Printf("Server is %s", server)
-	endpoint := client.New(cfg, server)
+	endpoint := newClient(cfg, server)
 
 	start := c.Int64(StartFlag.Name)
 	end := c.Int64(EndFlag.Name)
 	page := c.Int(PageFlag.Name)
 	pageSize := c.Int(PageSizeFlag.Name)
-	records, err := endpoint.RechargeRecords(c.Context, start, end, page, pageSize)
+	var records []client.RechargeRecord
+	if c.Bool(AllFlag.Name) {
+		records, err = endpoint.AllRechargeRecords(c.Context, start, end)
+	} else {
+		records, err = endpoint.RechargeRecords(c.Context, start, end, page, pageSize)
+	}
 	if err != nil {
 		log.Printf("Get recharge records error: %s", err)
 		return err
@@ -229,88 +263,225 @@ func recharged(c *cli.Context) error {
 }
 
 func bind(c *cli.Context) error {
-	code := c.String(CodeFlag.Name)
+	code := strings.TrimSpace(c.String(CodeFlag.Name))
 	if code == "" {
-		log.Println("you need specify invitation code")
-		return nil
+		return fmt.Errorf("you need specify invitation code with --%s", CodeFlag.Name)
 	}
-	cfg, err := parseConfig(c.String(ConfigFlag.Name))
+	s, err := loadConfig(c)
 	if err != nil {
 		return err
 	}
-	server := c.String(ServerFlag.Name)
+	cfg, server := s.Config, s.Server
 	log.Printf("Server is %s", server)
-	endpoint := client.New(cfg, server)
-	success, err := endpoint.Bind(c.Context, code)
-	if err != nil || !success {
+	endpoint := newClient(cfg, server)
+	return bindCode(c.Context, endpoint, code, c.Bool(DryRunFlag.Name))
+}
+
+// bindCode checks the code against the profile before binding it, with
+// dryRun only the check is done.
+func bindCode(ctx context.Context, endpoint *client.Client, code string, dryRun bool) error {
+	profile, err := endpoint.UserInfo(ctx)
+	if err != nil {
+		log.Printf("get user info error: %s", err)
+		return err
+	}
+	if profile.Code == code {
+		return fmt.Errorf("bind failed: %s is your own invitation code", code)
+	}
+	if dryRun {
+		log.Printf("dry run: %s is not your own invitation code, the server checks the rest", code)
+		return nil
+	}
+	result, err := endpoint.Bind(ctx, code)
+	if err != nil {
 		log.Printf("bind failed, error: %s", err)
 		return err
 	}
+	if !result.Bound {
+		return fmt.Errorf("bind failed: %s", result)
+	}
 	log.Println("bind success")
 	return nil
 }
 
 func address(c *cli.Context) error {
-	protocols := c.IntSlice(ProtocolFlag.Name)
-	types := c.IntSlice(TypeFlag.Name)
-	if protocols == nil {
-		protocols = append(protocols, 0, 1, 2)
+	// "address 1 0" is a shortcut of "address --protocol 1 --type 0"
+	protocolValues, typeValues := c.StringSlice(ProtocolFlag.Name), c.StringSlice(TypeFlag.Name)
+	if c.NArg() > 0 {
+		protocolValues = append(protocolValues, c.Args().Get(0))
 	}
-	if types == nil {
-		types = append(types, 0, 1, 2, 3)
+	if c.NArg() > 1 {
+		typeValues = append(typeValues, c.Args().Get(1))
 	}
-	pts := filter(protocols, types)
+	protocols, err := parseEnums(protocolIDs, protocolValues)
+	if err != nil {
+		return fmt.Errorf("bad --%s: %w", ProtocolFlag.Name, err)
+	}
+	types, err := parseEnums(typeIDs, typeValues)
+	if err != nil {
+		return fmt.Errorf("bad --%s: %w", TypeFlag.Name, err)
+	}
+	pairs := filter(protocols, types)
+	if values := c.StringSlice(PairFlag.Name); len(values) > 0 {
+		if len(protocolValues) > 0 || len(typeValues) > 0 {
+			return fmt.Errorf("--%s can not be combined with a protocol or type selection", PairFlag.Name)
+		}
+		pairs = nil
+		for _, v := range values {
+			p, err := parsePair(v)
+			if err != nil {
+				return err
+			}
+			if !containsPair(pairs, p) {
+				pairs = append(pairs, p)
+			}
+		}
+	}
+	client.SortPairs(pairs)
 
 	force := c.Bool(ForceAddressFlag.Name)
-	cfg, err := parseConfig(c.String(ConfigFlag.Name))
+	if c.Bool(DryRunFlag.Name) {
+		for _, p := range pairs {
+			if force {
+				log.Printf("dry run: would generate a new %s address", p)
+			} else {
+				log.Printf("dry run: would get the %s address", p)
+			}
+		}
+		return nil
+	}
+
+	profiles, err := selectedProfiles(c)
 	if err != nil {
 		return err
 	}
-	server := c.String(ServerFlag.Name)
-	log.Printf("Server is %s", server)
-	endpoint := client.New(cfg, server)
-	for e, _ := range pts {
-		addr, err := endpoint.Address(c.Context, e.protocol, e.cType, force)
-		if err != nil {
-			log.Printf("Get recharge address error: %s", err)
-		} else {
-			log.Printf("protocol: %d, type: %d, address: %s", e.protocol, e.cType, addr)
+	list, err := accounts(c)
+	if err != nil {
+		return err
+	}
+	if force && !c.Bool(YesFlag.Name) {
+		if err := confirmForce(pairs, list); err != nil {
+			return err
 		}
 	}
+	results := make([][]client.AddressResult, len(list))
+	client.ForEach(c.Context, concurrency, len(list), func(ctx context.Context, i int) error {
+		log.Printf("Server is %s", list[i].Client.Server)
+		results[i] = list[i].Client.Addresses(ctx, pairs, force)
+		return nil
+	})
 
-	return nil
+	entries := []addressOutput{}
+	for i, a := range list {
+		profile := c.String(ProfileFlag.Name)
+		if len(profiles) > 0 {
+			profile = a.Name
+		}
+		for _, r := range results[i] {
+			e := addressOutput{Profile: profile, Email: a.Client.Email(), AddressEntry: r.AddressEntry}
+			if r.Err != nil {
+				e.Error = r.Err.Error()
+			} else {
+				recordAddress(c, profile, a.Client, r.AddressEntry, force)
+			}
+			entries = append(entries, e)
+		}
+	}
+	return printResult(c, entries, func() {
+		for i, e := range entries {
+			if len(profiles) > 0 && (i == 0 || entries[i-1].Profile != e.Profile) {
+				log.Printf("profile %s (%s):", e.Profile, e.Email)
+			}
+			switch {
+			case e.Error != "":
+				log.Printf("Get recharge address error: %s", e.Error)
+			case e.Remarks != "":
+				log.Printf("protocol: %d, type: %d, address: %s, remarks: %s", e.Protocol, e.Type, e.Address, e.Remarks)
+			default:
+				log.Printf("protocol: %d, type: %d, address: %s", e.Protocol, e.Type, e.Address)
+			}
+		}
+	})
 }
 
-func parseConfig(filename string) (client.Config, error) {
-	var c client.Config
-	if err := hs.ParseJsonConfig(filename, &c); err != nil {
-		return c, err
-	}
-	return c, nil
+// addressOutput is an address of an account as printed by --output.
+type addressOutput struct {
+	Profile string `json:"profile,omitempty"`
+	Email   string `json:"email"`
+	client.AddressEntry
+	Error string `json:"error,omitempty"`
 }
 
-type pt struct {
-	protocol, cType int
+var (
+	// strictDecoding is set by --strict for all clients of the process
+	strictDecoding bool
+	// concurrency is set by --concurrency, it bounds the requests of
+	// fan-out operations, per client and across accounts
+	concurrency = 1
+
+	clientsMu sync.Mutex
+	clients   = make(map[string]*client.Client)
+)
+
+// newClient returns the client of an account, clients are kept for the whole
+// process so that a shell session or a batch logs in only once per account.
+func newClient(cfg client.Config, server string) *client.Client {
+	key := fmt.Sprintf("%s|%+v", server, cfg)
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := clients[key]; ok {
+		return c
+	}
+	c := client.New(cfg, server, client.WithStrictDecoding(strictDecoding), client.WithConcurrency(concurrency))
+	clients[key] = c
+	return c
 }
 
-var validPT = map[pt]bool{
-	{0, 0}: true,
-	{0, 1}: true,
-	{0, 2}: true,
-	{0, 3}: true,
-	{1, 0}: true,
-	{1, 1}: true,
-	{2, 0}: true,
+// confirmForce lists the accounts and pairs whose address will be replaced and asks
+// before going on.
+func confirmForce(pairs []client.Pair, list []exporter.Account) error {
+	if len(pairs) == 0 || len(list) == 0 {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, "New recharge addresses will be generated for the accounts:")
+	for _, a := range list {
+		fmt.Fprintf(os.Stderr, "  %s (%s)\n", a.Name, a.Client.Email())
+	}
+	fmt.Fprintln(os.Stderr, "and the pairs:")
+	for _, p := range pairs {
+		fmt.Fprintf(os.Stderr, "  %s\n", p)
+	}
+	fmt.Fprintln(os.Stderr, "Deposits to the current addresses may no longer be expected by users.")
+	ok, err := newPrompter().confirm(fmt.Sprintf("Rotate %d address(es), %d pair(s) for %d account(s)?",
+		len(pairs)*len(list), len(pairs), len(list)))
+	if err != nil {
+		return fmt.Errorf("confirmation failed (use --%s in scripts): %w", YesFlag.Name, err)
+	}
+	if !ok {
+		return errors.New("aborted, no address was changed")
+	}
+	return nil
 }
 
-func filter(protocols, types []int) map[pt]bool {
-	pts := make(map[pt]bool)
+// filter returns the valid pairs of the protocols and types.
+func filter(protocols, types []int) []client.Pair {
+	var pairs []client.Pair
 	for _, p := range protocols {
 		for _, t := range types {
-			if validPT[pt{p, t}] {
-				pts[pt{p, t}] = true
+			pair := client.Pair{Protocol: p, Type: t}
+			if pair.Valid() && !containsPair(pairs, pair) {
+				pairs = append(pairs, pair)
 			}
 		}
 	}
-	return pts
+	return pairs
+}
+
+func containsPair(pairs []client.Pair, p client.Pair) bool {
+	for _, v := range pairs {
+		if v == p {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/urfave/cli/v2"
+)
+
+var tuiCommand = &cli.Command{
+	Action: tui,
+	Name:   "tui",
+	Usage:  "Full-screen dashboard of profile, recharges, rewards and addresses",
+	Description: `Keys: Tab/Shift-Tab switch pane, arrows/PgUp/PgDn scroll, / filter the
+recharge history, Esc leave the filter, r refresh now, q quit.`,
+	Flags: []cli.Flag{
+		IntervalFlag,
+		WarnFlag,
+	},
+}
+
+// dashboard is the data shown by the tui, fetched in one go.
+type dashboard struct {
+	profile     *client.Profile
+	recharges   []client.RechargeRecord
+	invitations []client.InvitationRecord
+	addresses   []client.AddressResult
+	fetchedAt   time.Time
+	err         error
+}
+
+func fetchDashboard(c *cli.Context, endpoint *client.Client) dashboard {
+	d := dashboard{fetchedAt: time.Now()}
+	if d.profile, d.err = endpoint.UserInfo(c.Context); d.err != nil {
+		return d
+	}
+	if d.recharges, d.err = endpoint.AllRechargeRecords(c.Context, 0, 0); d.err != nil {
+		return d
+	}
+	if d.invitations, d.err = endpoint.AllInvitationRecords(c.Context, 0, 0); d.err != nil {
+		return d
+	}
+	d.addresses = endpoint.Addresses(c.Context, client.ValidPairs, false)
+	for _, a := range d.addresses {
+		if a.Err == nil {
+			recordAddress(c, c.String(ProfileFlag.Name), endpoint, a.AddressEntry, false)
+		}
+	}
+	return d
+}
+
+func formatMillis(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return time.Unix(ms/1000, 0).Format("2006-01-02 15:04")
+}
+
+// tuiView holds the widgets of the dashboard.
+type tuiView struct {
+	app         *tview.Application
+	profile     *tview.TextView
+	addresses   *tview.Table
+	filter      *tview.InputField
+	recharges   *tview.Table
+	invitations *tview.Table
+	status      *tview.TextView
+	warn        time.Duration
+
+	data dashboard // only accessed from the application goroutine
+}
+
+func newTUIView(warn time.Duration) *tuiView {
+	v := &tuiView{
+		app:         tview.NewApplication(),
+		profile:     tview.NewTextView().SetDynamicColors(true),
+		addresses:   tview.NewTable().SetFixed(1, 0).SetSelectable(true, false),
+		filter:      tview.NewInputField().SetLabel("Filter: "),
+		recharges:   tview.NewTable().SetFixed(1, 0).SetSelectable(true, false),
+		invitations: tview.NewTable().SetFixed(1, 0).SetSelectable(true, false),
+		status:      tview.NewTextView().SetDynamicColors(true),
+		warn:        warn,
+	}
+	v.profile.SetBorder(true).SetTitle(" Profile ")
+	v.addresses.SetBorder(true).SetTitle(" Recharge addresses ")
+	v.recharges.SetBorder(true).SetTitle(" Recharge history ")
+	v.invitations.SetBorder(true).SetTitle(" Invitation rewards ")
+	v.filter.SetChangedFunc(func(string) { v.renderRecharges() })
+	v.filter.SetDoneFunc(func(tcell.Key) { v.app.SetFocus(v.recharges) })
+	return v
+}
+
+func (v *tuiView) layout() tview.Primitive {
+	top := tview.NewFlex().
+		AddItem(v.profile, 0, 1, false).
+		AddItem(v.addresses, 0, 2, false)
+	middle := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(v.filter, 1, 0, false).
+		AddItem(v.recharges, 0, 1, true)
+	return tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(top, 9, 0, false).
+		AddItem(middle, 0, 2, true).
+		AddItem(v.invitations, 0, 1, false).
+		AddItem(v.status, 1, 0, false)
+}
+
+func setHeader(t *tview.Table, titles ...string) {
+	for i, title := range titles {
+		t.SetCell(0, i, tview.NewTableCell(title).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	}
+}
+
+func setRow(t *tview.Table, row int, values ...string) {
+	for i, value := range values {
+		t.SetCell(row, i, tview.NewTableCell(value))
+	}
+}
+
+// render redraws all panes from v.data, must run in the application goroutine.
+func (v *tuiView) render() {
+	d := v.data
+	if d.err != nil {
+		v.status.SetText(fmt.Sprintf("[red]%s: %s[-]  r refresh  q quit", d.fetchedAt.Format("15:04:05"), d.err))
+		return
+	}
+	v.status.SetText(fmt.Sprintf("updated %s  Tab pane  / filter  r refresh  q quit", d.fetchedAt.Format("15:04:05")))
+
+	p := d.profile
+	state, code := subscriptionState(p.RemainingTime, v.warn)
+	color := map[int]string{statusOK: "green", statusWarning: "yellow", statusCritical: "red"}[code]
+	v.profile.SetText(fmt.Sprintf("Email:     %s\nCode:      %s\nStatus:    [%s]%s[-]\nExpire at: %s\nRemaining: %s",
+		p.Email, p.Code, color, state, p.ExpireAt.Format("2006-01-02 15:04"), p.RemainingTime.Truncate(time.Minute)))
+
+	v.addresses.Clear()
+	setHeader(v.addresses, "protocol", "type", "address")
+	for i, a := range d.addresses {
+		addr := a.Address
+		if a.Err != nil {
+			addr = "error: " + a.Err.Error()
+		}
+		setRow(v.addresses, i+1, strconv.Itoa(a.Protocol), strconv.Itoa(a.Type), addr)
+	}
+
+	v.renderRecharges()
+
+	v.invitations.Clear()
+	setHeader(v.invitations, "nickName", "rewardType", "rewardNumber", "rewardUnit", "rewardTime")
+	for i, r := range d.invitations {
+		setRow(v.invitations, i+1, r.NickName, fmt.Sprint(r.RewardType), fmt.Sprint(r.RewardNumber),
+			fmt.Sprint(r.RewardUnit), formatMillis(r.RewardTime))
+	}
+}
+
+// renderRecharges shows the recharge records matching the filter.
+func (v *tuiView) renderRecharges() {
+	filter := strings.ToLower(v.filter.GetText())
+	v.recharges.Clear()
+	setHeader(v.recharges, "time", "chain", "symbol", "amount", "from", "to", "arrival")
+	row := 1
+	for _, r := range v.data.recharges {
+		values := []string{formatMillis(r.RechargeTime), r.Chain, r.Symbol, fmt.Sprint(r.Amount),
+			r.RechargeFrom, r.RechargeTo, formatMillis(r.ArrivalTime)}
+		if filter != "" && !strings.Contains(strings.ToLower(strings.Join(values, " ")), filter) {
+			continue
+		}
+		setRow(v.recharges, row, values...)
+		row++
+	}
+}
+
+func tui(c *cli.Context) error {
+	// a ticker panics on a non-positive interval, with the terminal in raw mode
+	if c.Duration(IntervalFlag.Name) <= 0 {
+		return fmt.Errorf("--%s must be positive", IntervalFlag.Name)
+	}
+	s, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	endpoint := newClient(s.Config, s.Server)
+
+	// the client logs every request, that would break the screen
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	v := newTUIView(c.Duration(WarnFlag.Name))
+	refresh := make(chan struct{}, 1)
+	panes := []tview.Primitive{v.recharges, v.invitations, v.addresses}
+	focus := 0
+	v.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if v.filter.HasFocus() {
+			return event
+		}
+		switch event.Key() {
+		case tcell.KeyTab:
+			focus = (focus + 1) % len(panes)
+			v.app.SetFocus(panes[focus])
+			return nil
+		case tcell.KeyBacktab:
+			focus = (focus + len(panes) - 1) % len(panes)
+			v.app.SetFocus(panes[focus])
+			return nil
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'q':
+				v.app.Stop()
+				return nil
+			case 'r':
+				select {
+				case refresh <- struct{}{}:
+				default:
+				}
+				return nil
+			case '/':
+				v.app.SetFocus(v.filter)
+				return nil
+			}
+		}
+		return event
+	})
+
+	// done is closed once the screen is gone, updates queued later would
+	// never be drawn
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(c.Duration(IntervalFlag.Name))
+		defer ticker.Stop()
+		for {
+			v.app.QueueUpdateDraw(func() { v.status.SetText("refreshing...") })
+			d := fetchDashboard(c, endpoint)
+			select {
+			case <-done:
+				return
+			default:
+			}
+			v.app.QueueUpdateDraw(func() {
+				v.data = d
+				v.render()
+			})
+			select {
+			case <-done:
+				return
+			case <-c.Context.Done():
+				v.app.Stop()
+				return
+			case <-ticker.C:
+			case <-refresh:
+			}
+		}
+	}()
+
+	err = v.app.SetRoot(v.layout(), true).SetFocus(v.recharges).Run()
+	close(done)
+	return err
+}
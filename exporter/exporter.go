@@ -0,0 +1,302 @@
+// Package exporter exposes the state of caitan accounts as Prometheus metrics
+// in the text exposition format.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+// Account is one account to export, Name is used as the account label.
+type Account struct {
+	Name   string
+	Client *client.Client
+}
+
+// buckets of the request duration histogram, in seconds.
+var buckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Exporter collects the metrics of all accounts periodically and serves them.
+type Exporter struct {
+	accounts []Account
+
+	mu       sync.Mutex
+	gauges   map[string]map[string]float64 // metric => labels => value
+	counters map[string]map[string]float64
+	latency  map[string]*histogram // endpoint => histogram
+}
+
+func New(accounts []Account) *Exporter {
+	return &Exporter{
+		accounts: accounts,
+		gauges:   make(map[string]map[string]float64),
+		counters: make(map[string]map[string]float64),
+		latency:  make(map[string]*histogram),
+	}
+}
+
+type metric struct {
+	help, kind string
+}
+
+var metrics = map[string]metric{
+	"ciac_subscription_remaining_seconds":        {"Seconds until the subscription expires.", "gauge"},
+	"ciac_subscription_expiry_timestamp_seconds": {"Unix time the subscription expires.", "gauge"},
+	"ciac_deposits":                        {"Number of deposits.", "gauge"},
+	"ciac_deposits_amount":                 {"Total amount of deposits.", "gauge"},
+	"ciac_last_deposit_timestamp_seconds":  {"Unix time of the last deposit.", "gauge"},
+	"ciac_invited_users":                   {"Number of invited users.", "gauge"},
+	"ciac_invitation_rewards":              {"Total number of invitation rewards.", "gauge"},
+	"ciac_last_collect_timestamp_seconds":  {"Unix time of the last successful collection.", "gauge"},
+	"ciac_collect_errors_total":            {"Failed collections.", "counter"},
+	"ciac_client_requests_total":           {"Requests sent to the server.", "counter"},
+	"ciac_client_request_duration_seconds": {"Duration of requests sent to the server.", "histogram"},
+}
+
+// labels formats label pairs, values are escaped as required by the format.
+func labels(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(kv[i+1])
+		fmt.Fprintf(&b, `%s="%s"`, kv[i], v)
+	}
+	return b.String()
+}
+
+func (e *Exporter) setLocked(metric, labels string, v float64) {
+	if e.gauges[metric] == nil {
+		e.gauges[metric] = make(map[string]float64)
+	}
+	e.gauges[metric][labels] = v
+}
+
+func (e *Exporter) addLocked(metric, labels string, delta float64) {
+	if e.gauges[metric] == nil {
+		e.gauges[metric] = make(map[string]float64)
+	}
+	e.gauges[metric][labels] += delta
+}
+
+func (e *Exporter) inc(metric, labels string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counters[metric] == nil {
+		e.counters[metric] = make(map[string]float64)
+	}
+	e.counters[metric][labels]++
+}
+
+// deleteAccountLocked drops the gauges of an account before they are set again, so
+// that e.g. a symbol without deposits any more disappears.
+func (e *Exporter) deleteAccountLocked(account string) {
+	prefix := labels("account", account)
+	for _, values := range e.gauges {
+		for l := range values {
+			if l == prefix || strings.HasPrefix(l, prefix+",") {
+				delete(values, l)
+			}
+		}
+	}
+}
+
+// Collect fetches the state of all accounts once.
+func (e *Exporter) Collect(ctx context.Context) {
+	for _, a := range e.accounts {
+		if err := e.collect(ctx, a); err != nil {
+			log.Printf("collect account %s error: %s", a.Name, err)
+			e.inc("ciac_collect_errors_total", labels("account", a.Name))
+		}
+	}
+}
+
+func (e *Exporter) collect(ctx context.Context, a Account) error {
+	profile, err := a.Client.UserInfo(ctx)
+	if err != nil {
+		return err
+	}
+	recharges, err := a.Client.AllRechargeRecords(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+	invitations, err := a.Client.AllInvitationRecords(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.deleteAccountLocked(a.Name)
+	account := labels("account", a.Name)
+	e.setLocked("ciac_subscription_remaining_seconds", account, profile.RemainingTime.Seconds())
+	e.setLocked("ciac_subscription_expiry_timestamp_seconds", account, float64(profile.ExpireAt.Unix()))
+
+	var last int64
+	for _, r := range recharges {
+		l := labels("account", a.Name, "chain", r.Chain, "symbol", r.Symbol)
+		e.addLocked("ciac_deposits", l, 1)
+		e.addLocked("ciac_deposits_amount", l, r.Amount)
+		if r.RechargeTime > last {
+			last = r.RechargeTime
+		}
+	}
+	if last > 0 {
+		e.setLocked("ciac_last_deposit_timestamp_seconds", account, float64(last)/1000)
+	}
+
+	users := make(map[string]bool)
+	for _, r := range invitations {
+		users[r.NickName] = true
+		l := labels("account", a.Name, "reward_type", strconv.Itoa(r.RewardType), "reward_unit", strconv.Itoa(r.RewardUnit))
+		e.addLocked("ciac_invitation_rewards", l, float64(r.RewardNumber))
+	}
+	e.setLocked("ciac_invited_users", account, float64(len(users)))
+	e.setLocked("ciac_last_collect_timestamp_seconds", account, float64(time.Now().Unix()))
+	return nil
+}
+
+// Run collects every interval until ctx is done, interval must be positive.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		e.Collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Write writes all metrics in the text exposition format.
+func (e *Exporter) Write(w io.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := metrics[name]
+		values := e.gauges[name]
+		if m.kind == "counter" {
+			values = e.counters[name]
+		}
+		if m.kind == "histogram" {
+			if len(e.latency) == 0 {
+				continue
+			}
+		} else if len(values) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.kind)
+		if m.kind == "histogram" {
+			e.writeLatency(w, name)
+			continue
+		}
+		ls := make([]string, 0, len(values))
+		for l := range values {
+			ls = append(ls, l)
+		}
+		sort.Strings(ls)
+		for _, l := range ls {
+			fmt.Fprintf(w, "%s{%s} %s\n", name, l, strconv.FormatFloat(values[l], 'g', -1, 64))
+		}
+	}
+}
+
+func (e *Exporter) writeLatency(w io.Writer, name string) {
+	endpoints := make([]string, 0, len(e.latency))
+	for endpoint := range e.latency {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		h := e.latency[endpoint]
+		var cumulative uint64
+		for i, le := range buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s} %d\n", name, labels("endpoint", endpoint, "le", strconv.FormatFloat(le, 'g', -1, 64)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s} %d\n", name, labels("endpoint", endpoint, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels("endpoint", endpoint), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels("endpoint", endpoint), h.count)
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.Write(w)
+}
+
+// observe records one request to the server.
+func (e *Exporter) observe(endpoint string, d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	e.inc("ciac_client_requests_total", labels("endpoint", endpoint, "result", result))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	h := e.latency[endpoint]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(buckets))}
+		e.latency[endpoint] = h
+	}
+	s := d.Seconds()
+	for i, le := range buckets {
+		if s <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+type instrumented struct {
+	e    *Exporter
+	next http.RoundTripper
+}
+
+func (t instrumented) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	failed := err
+	if err == nil && resp.StatusCode >= 400 {
+		failed = fmt.Errorf("status %s", resp.Status)
+	}
+	t.e.observe(path.Base(r.URL.Path), time.Since(start), failed)
+	return resp, err
+}
+
+// Transport wraps next (nil means http.DefaultTransport) to record the
+// latency and errors of every request per endpoint.
+func (e *Exporter) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return instrumented{e: e, next: next}
+}
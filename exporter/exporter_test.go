@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+// standIn answers like the caitan server for one account.
+func standIn() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pager") != "" {
+			// everything fits on the first page
+			_, _ = w.Write([]byte(`{"state":200,"data":{"result":1,"record":[]}}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "jwt", Value: "token", MaxAge: 3600})
+			_, _ = w.Write([]byte(`{"state":200,"data":{"result":1}}`))
+		case "/user":
+			_, _ = w.Write([]byte(`{"state":200,"data":{"result":1,"email":"a@example.com","code":"AB12","remainingTime":3600000}}`))
+		case "/rechargeRecord":
+			_, _ = w.Write([]byte(`{"state":200,"data":{"result":1,"record":[
+				{"chain":"TRON","symbol":"USDT","amount":10,"rechargeTime":1627392295000},
+				{"chain":"TRON","symbol":"USDT","amount":20.5,"rechargeTime":1627478695000},
+				{"chain":"ETH","symbol":"USDT","amount":5,"rechargeTime":1627000000000}]}}`))
+		case "/invitationRecord":
+			_, _ = w.Write([]byte(`{"state":200,"data":{"result":1,"record":[
+				{"nickName":"alice","rewardType":1,"rewardNumber":7,"rewardUnit":1},
+				{"nickName":"alice","rewardType":1,"rewardNumber":3,"rewardUnit":1}]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestExporter(t *testing.T) {
+	server := standIn()
+	defer server.Close()
+
+	cfg := client.Config{Email: "a@example.com", Password: "p", TokenFile: filepath.Join(t.TempDir(), "token.json")}
+	e := New([]Account{{Name: "main", Client: client.New(cfg, server.URL)}})
+	client.SetTransport(e.Transport(nil))
+	defer client.SetTransport(nil)
+
+	e.Collect(context.Background())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`ciac_subscription_remaining_seconds{account="main"} 3600`,
+		`ciac_deposits{account="main",chain="TRON",symbol="USDT"} 2`,
+		`ciac_deposits_amount{account="main",chain="TRON",symbol="USDT"} 30.5`,
+		`ciac_deposits_amount{account="main",chain="ETH",symbol="USDT"} 5`,
+		`ciac_last_deposit_timestamp_seconds{account="main"} 1.627478695e+09`,
+		`ciac_invited_users{account="main"} 1`,
+		`ciac_invitation_rewards{account="main",reward_type="1",reward_unit="1"} 10`,
+		`ciac_client_requests_total{endpoint="login",result="ok"} 1`,
+		`ciac_client_request_duration_seconds_count{endpoint="user"} 1`,
+		"# TYPE ciac_client_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+	if t.Failed() {
+		t.Log(body)
+	}
+
+	// a broken server is counted as an error
+	server.Close()
+	e.Collect(context.Background())
+	var buf bytes.Buffer
+	e.Write(&buf)
+	if !strings.Contains(buf.String(), `ciac_collect_errors_total{account="main"} 1`) {
+		t.Errorf("collect error not counted:\n%s", buf.String())
+	}
+}
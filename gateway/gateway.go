@@ -0,0 +1,214 @@
+// Package gateway exposes the client operations as a small JSON API, so that
+// tools not written in Go can use an account without seeing its password.
+package gateway
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Resolver returns the client of an account, "" is the default account.
+type Resolver func(account string) (*client.Client, error)
+
+// Gateway is the http.Handler of the API.
+type Gateway struct {
+	key     string
+	resolve Resolver
+	mux     *http.ServeMux
+}
+
+// New creates a gateway, every request but /openapi.json must carry key as
+// a bearer token.
+func New(key string, resolve Resolver) *Gateway {
+	g := &Gateway{key: key, resolve: resolve, mux: http.NewServeMux()}
+	g.mux.HandleFunc("/openapi.json", g.openAPI)
+	g.mux.HandleFunc("/v1/profile", g.auth(g.profile))
+	g.mux.HandleFunc("/v1/recharges", g.auth(g.recharges))
+	g.mux.HandleFunc("/v1/invitations", g.auth(g.invitations))
+	g.mux.HandleFunc("/v1/address", g.auth(g.address))
+	g.mux.HandleFunc("/v1/bind", g.auth(g.bind))
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func (g *Gateway) auth(next func(http.ResponseWriter, *http.Request, *client.Client)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if g.key == "" || subtle.ConstantTimeCompare([]byte(token), []byte(g.key)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong api key"))
+			return
+		}
+		c, err := g.resolve(r.URL.Query().Get("account"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		next(w, r, c)
+	}
+}
+
+func (g *Gateway) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPI)
+}
+
+func (g *Gateway) profile(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	profile, err := c.UserInfo(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// paging reads start, end, page, size and all from the query.
+type paging struct {
+	start, end int64
+	page, size int
+	all        bool
+}
+
+func parsePaging(r *http.Request) (paging, error) {
+	q := r.URL.Query()
+	p := paging{size: 10}
+	var err error
+	for name, dst := range map[string]*int64{"start": &p.start, "end": &p.end} {
+		if v := q.Get(name); v != "" {
+			if *dst, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return p, errors.New("bad " + name)
+			}
+		}
+	}
+	for name, dst := range map[string]*int{"page": &p.page, "size": &p.size} {
+		if v := q.Get(name); v != "" {
+			if *dst, err = strconv.Atoi(v); err != nil {
+				return p, errors.New("bad " + name)
+			}
+		}
+	}
+	p.all = q.Get("all") == "true"
+	return p, nil
+}
+
+func (g *Gateway) recharges(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	p, err := parsePaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var records []client.RechargeRecord
+	if p.all {
+		records, err = c.AllRechargeRecords(r.Context(), p.start, p.end)
+	} else {
+		records, err = c.RechargeRecords(r.Context(), p.start, p.end, p.page, p.size)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	if records == nil {
+		records = []client.RechargeRecord{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (g *Gateway) invitations(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	p, err := parsePaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var records []client.InvitationRecord
+	if p.all {
+		records, err = c.AllInvitationRecords(r.Context(), p.start, p.end)
+	} else {
+		records, err = c.InvitationRecords(r.Context(), p.start, p.end, p.page, p.size)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	if records == nil {
+		records = []client.InvitationRecord{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (g *Gateway) address(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	q := r.URL.Query()
+	protocol, err1 := strconv.Atoi(q.Get("protocol"))
+	cType, err2 := strconv.Atoi(q.Get("type"))
+	if err1 != nil || err2 != nil {
+		writeError(w, http.StatusBadRequest, errors.New("protocol and type are required"))
+		return
+	}
+	entry, err := c.Address(r.Context(), protocol, cType, false)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+type bindRequest struct {
+	Code string `json:"code"`
+}
+
+type bindResponse struct {
+	Result string `json:"result"`
+}
+
+func (g *Gateway) bind(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+	var req bindRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Code = strings.TrimSpace(req.Code); req.Code == "" {
+		writeError(w, http.StatusBadRequest, errors.New("no invitation code"))
+		return
+	}
+	result, err := c.Bind(r.Context(), req.Code)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	status := http.StatusOK
+	if !result.Bound {
+		status = http.StatusConflict
+	}
+	log.Printf("bind %s: %s", req.Code, result)
+	writeJSON(w, status, bindResponse{Result: result.String()})
+}
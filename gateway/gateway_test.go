@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caitan-app/ciac/client"
+	"github.com/caitan-app/ciac/client/cassette"
+)
+
+func TestGateway(t *testing.T) {
+	replayer, err := cassette.NewReplayer("../client/testdata/session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetTransport(replayer)
+	defer client.SetTransport(nil)
+
+	cfg := client.Config{Email: "user@example.com", Password: "p", TokenFile: filepath.Join(t.TempDir(), "token.json")}
+	c := client.New(cfg, "https://test.caitan.app")
+	g := New("secret", func(account string) (*client.Client, error) {
+		if account != "" {
+			return nil, errors.New("unknown account")
+		}
+		return c, nil
+	})
+
+	do := func(method, target, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/openapi.json", "", ""); w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("openapi: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/v1/profile", "wrong", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong key: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/v1/profile", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no key: %d", w.Code)
+	}
+	keyless := New("", g.resolve)
+	r := httptest.NewRequest(http.MethodGet, "/v1/profile", nil)
+	w := httptest.NewRecorder()
+	if keyless.ServeHTTP(w, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("empty gateway key: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/v1/profile?account=bob", "secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown account: %d", w.Code)
+	}
+
+	w = do(http.MethodGet, "/v1/profile", "secret", "")
+	var profile client.Profile
+	if err = json.Unmarshal(w.Body.Bytes(), &profile); err != nil || profile.Code != "AB12cd" {
+		t.Errorf("profile: %d %s", w.Code, w.Body)
+	}
+	w = do(http.MethodGet, "/v1/invitations?size=10", "secret", "")
+	var invitations []client.InvitationRecord
+	if err = json.Unmarshal(w.Body.Bytes(), &invitations); err != nil || len(invitations) != 2 {
+		t.Errorf("invitations: %d %s", w.Code, w.Body)
+	}
+	w = do(http.MethodGet, "/v1/recharges", "secret", "")
+	var recharges []client.RechargeRecord
+	if err = json.Unmarshal(w.Body.Bytes(), &recharges); err != nil || len(recharges) != 1 {
+		t.Errorf("recharges: %d %s", w.Code, w.Body)
+	}
+	if w = do(http.MethodGet, "/v1/address?protocol=0", "secret", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("address without type: %d", w.Code)
+	}
+	if w = do(http.MethodPost, "/v1/bind", "secret", `{"code":" "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("bind no code: %d", w.Code)
+	}
+	if w = do(http.MethodPost, "/v1/bind", "secret", `{"code":"XY34ab"}`); w.Code != http.StatusOK {
+		t.Errorf("bind: %d %s", w.Code, w.Body)
+	}
+}
+
+// TestGatewayParallel shares one client between concurrent requests, run it
+// with -race.
+func TestGatewayParallel(t *testing.T) {
+	replayer, err := cassette.NewReplayer("../client/testdata/session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetTransport(replayer)
+	defer client.SetTransport(nil)
+
+	cfg := client.Config{Email: "user@example.com", Password: "p", TokenFile: filepath.Join(t.TempDir(), "token.json")}
+	c := client.New(cfg, "https://test.caitan.app", client.WithConcurrency(2))
+	g := New("secret", func(string) (*client.Client, error) { return c, nil })
+
+	targets := []string{"/v1/profile", "/v1/invitations?size=10", "/v1/recharges", "/v1/address?protocol=0&type=0"}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for _, target := range targets {
+			wg.Add(1)
+			go func(target string) {
+				defer wg.Done()
+				r := httptest.NewRequest(http.MethodGet, target, nil)
+				r.Header.Set("Authorization", "Bearer secret")
+				w := httptest.NewRecorder()
+				g.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					t.Errorf("%s: %d %s", target, w.Code, w.Body)
+				}
+			}(target)
+		}
+	}
+	wg.Wait()
+}
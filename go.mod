@@ -3,6 +3,16 @@ module github.com/caitan-app/ciac
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/cpuguy83/go-md2man/v2 v2.0.0 // indirect
+	github.com/gdamore/tcell/v2 v2.3.3
+	github.com/kr/text v0.2.0 // indirect
+	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
+	github.com/peterh/liner v1.2.1
+	github.com/rivo/tview v0.0.0-20210624165335-29d673af0ce2
 	github.com/urfave/cli/v2 v2.3.0
-	github.com/xyths/hs v0.29.1
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
+	golang.org/x/term v0.0.0-20210615171337-6886f2dfbf5b
+	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
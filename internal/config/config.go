@@ -0,0 +1,491 @@
+// Package config merges the ciac configuration from several layers: built-in
+// defaults, the per-user file, the project file, CIAC_* environment variables
+// and command line flags, each one overriding the previous.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caitan-app/ciac/client"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultServer is the server used when no layer sets one.
+const DefaultServer = "https://test.caitan.app"
+
+// Settings is the effective configuration.
+type Settings struct {
+	Server string
+	// InviteLink is the shareable invite link, {code} is replaced by the
+	// invitation code
+	InviteLink string
+	client.Config
+}
+
+// Key is a known configuration key.
+type Key struct {
+	Name   string // as written in config files
+	Env    string // environment variable
+	Secret bool   // masked when printed
+}
+
+var Keys = []Key{
+	{Name: "server", Env: "CIAC_SERVER"},
+	{Name: "email", Env: "CIAC_EMAIL"},
+	{Name: "password", Env: "CIAC_PASSWORD", Secret: true},
+	{Name: "tokenFile", Env: "CIAC_TOKEN_FILE"},
+	{Name: "sendCookie", Env: "CIAC_SEND_COOKIE"},
+	{Name: "inviteLink", Env: "CIAC_INVITE_LINK"},
+}
+
+// ErrUnknownKey is returned for keys not in Keys.
+var ErrUnknownKey = errors.New("unknown config key")
+
+func normalize(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// Lookup finds a key by name, ignoring case, '-' and '_'.
+func Lookup(name string) (Key, error) {
+	n := normalize(name)
+	for _, k := range Keys {
+		if normalize(k.Name) == n {
+			return k, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w: %s", ErrUnknownKey, name)
+}
+
+// Layer is a set of values from one source.
+type Layer struct {
+	Source string            // e.g. "default", a file name, "env"
+	Values map[string]string // Key.Name => value
+
+	// File is the config file holding the values, empty if they do not come
+	// from a file. Profile is set for the layer of a profile section.
+	File    string
+	Profile string
+
+	// only set by files
+	Profiles     map[string]map[string]string // profile name => Key.Name => value
+	Environments map[string]string            // environment name => server
+	Codes        []string                     // saved invitation codes
+	Accounts     map[string]string            // accounting key => account name
+}
+
+// Defaults returns the built-in defaults, the token is kept in the user config dir.
+func Defaults() Layer {
+	l := Layer{
+		Source:       "default",
+		Values:       map[string]string{"server": DefaultServer},
+		Environments: map[string]string{"test": DefaultServer},
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		l.Values["tokenFile"] = filepath.Join(dir, "ciac", "token.json")
+	}
+	return l
+}
+
+// Env returns the values set by CIAC_* environment variables.
+func Env(lookup func(string) (string, bool)) Layer {
+	l := Layer{Source: "env", Values: make(map[string]string)}
+	for _, k := range Keys {
+		if v, ok := lookup(k.Env); ok && v != "" {
+			l.Values[k.Name] = v
+		}
+	}
+	return l
+}
+
+// extensions are the accepted config file formats, in lookup order.
+var extensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// Find returns the first existing file named base plus one of the accepted
+// extensions in dir, or base.json if there is none.
+func Find(dir, base string) string {
+	for _, ext := range extensions {
+		filename := filepath.Join(dir, base+ext)
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+	}
+	return filepath.Join(dir, base+".json")
+}
+
+// UserFile returns the per-user config file in the XDG config dir.
+func UserFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return Find(filepath.Join(dir, "ciac"), "config"), nil
+}
+
+// readRaw decodes a JSON, YAML or TOML file, chosen by the extension.
+func readRaw(filename string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		_, err = toml.Decode(string(data), &raw)
+	default:
+		err = json.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return raw, nil
+}
+
+// scalars returns the known keys of raw with a scalar value.
+func scalars(raw map[string]interface{}) map[string]string {
+	values := make(map[string]string)
+	for name, v := range raw {
+		k, err := Lookup(name)
+		if err != nil {
+			continue
+		}
+		switch v.(type) {
+		case string, bool, int, int64, float64:
+			values[k.Name] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
+
+// File reads a config file, values of unknown keys are skipped. Besides the
+// keys in Keys a file may hold "profiles", "environments", "invitationCodes"
+// and the "accounts" used by export:
+//
+//	profiles:
+//	  alice: {email: alice@example.com, password: secret}
+//	environments:
+//	  local: http://localhost:8080
+//	invitationCodes: [AB12cd]
+//	accounts:
+//	  deposit:TRON:USDT: Assets:Crypto:Tron:USDT
+func File(filename string) (Layer, error) {
+	raw, err := readRaw(filename)
+	if err != nil {
+		return Layer{}, err
+	}
+	l := Layer{
+		Source:       filename,
+		Values:       scalars(raw),
+		File:         filename,
+		Profiles:     make(map[string]map[string]string),
+		Environments: make(map[string]string),
+		Accounts:     make(map[string]string),
+	}
+	if profiles, ok := raw["profiles"].(map[string]interface{}); ok {
+		for name, p := range profiles {
+			if values, ok := p.(map[string]interface{}); ok {
+				l.Profiles[name] = scalars(values)
+			}
+		}
+	}
+	if envs, ok := raw["environments"].(map[string]interface{}); ok {
+		for name, server := range envs {
+			if s, ok := server.(string); ok {
+				l.Environments[name] = s
+			}
+		}
+	}
+	if accounts, ok := raw["accounts"].(map[string]interface{}); ok {
+		for key, account := range accounts {
+			if s, ok := account.(string); ok {
+				l.Accounts[key] = s
+			}
+		}
+	}
+	if codes, ok := raw["invitationCodes"].([]interface{}); ok {
+		for _, code := range codes {
+			if s, ok := code.(string); ok {
+				l.Codes = append(l.Codes, s)
+			}
+		}
+	}
+	return l, nil
+}
+
+// Config is the result of merging layers.
+type Config struct {
+	values  map[string]string
+	sources map[string]string
+	layers  map[string]Layer
+
+	profiles     map[string]Layer
+	environments map[string]string
+	codes        []string
+	accounts     map[string]string
+}
+
+// Merge merges layers, later layers override earlier ones.
+func Merge(layers ...Layer) Config {
+	c := Config{
+		values:       make(map[string]string),
+		sources:      make(map[string]string),
+		layers:       make(map[string]Layer),
+		profiles:     make(map[string]Layer),
+		environments: make(map[string]string),
+		accounts:     make(map[string]string),
+	}
+	seen := make(map[string]bool)
+	for _, l := range layers {
+		for k, v := range l.Values {
+			c.values[k] = v
+			c.sources[k] = l.Source
+			c.layers[k] = l
+		}
+		for name, values := range l.Profiles {
+			p, ok := c.profiles[name]
+			if !ok {
+				p = Layer{Source: "profile " + name, Values: make(map[string]string), Profile: name}
+			}
+			// the last file defining the profile wins, so new values go there
+			p.File = l.File
+			for k, v := range values {
+				p.Values[k] = v
+			}
+			c.profiles[name] = p
+		}
+		for name, server := range l.Environments {
+			c.environments[name] = server
+		}
+		for key, account := range l.Accounts {
+			c.accounts[key] = account
+		}
+		for _, code := range l.Codes {
+			if !seen[code] {
+				seen[code] = true
+				c.codes = append(c.codes, code)
+			}
+		}
+	}
+	return c
+}
+
+// Profiles returns the names of all profiles, sorted.
+func (c Config) Profiles() []string {
+	names := make([]string, 0, len(c.profiles))
+	for name := range c.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the values of a profile as a layer.
+func (c Config) Profile(name string) (Layer, error) {
+	p, ok := c.profiles[name]
+	if !ok {
+		return Layer{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// Environments returns the names of all environments, sorted.
+func (c Config) Environments() []string {
+	names := make([]string, 0, len(c.environments))
+	for name := range c.environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Environment returns a layer setting the server of an environment.
+func (c Config) Environment(name string) (Layer, error) {
+	server, ok := c.environments[name]
+	if !ok {
+		return Layer{}, fmt.Errorf("unknown environment %q", name)
+	}
+	return Layer{Source: "environment " + name, Values: map[string]string{"server": server}}, nil
+}
+
+// InvitationCodes returns the saved invitation codes.
+func (c Config) InvitationCodes() []string {
+	return c.codes
+}
+
+// Accounts returns the account names configured for export.
+func (c Config) Accounts() map[string]string {
+	return c.accounts
+}
+
+// Get returns the value of a key and the layer it came from.
+func (c Config) Get(name string) (value, source string, err error) {
+	k, err := Lookup(name)
+	if err != nil {
+		return "", "", err
+	}
+	return c.values[k.Name], c.sources[k.Name], nil
+}
+
+// Origin returns the layer the value of a key came from, the zero Layer if
+// no layer sets it.
+func (c Config) Origin(name string) (Layer, error) {
+	k, err := Lookup(name)
+	if err != nil {
+		return Layer{}, err
+	}
+	return c.layers[k.Name], nil
+}
+
+// Settings converts the merged values.
+func (c Config) Settings() (Settings, error) {
+	s := Settings{
+		Server:     c.values["server"],
+		InviteLink: c.values["inviteLink"],
+		Config: client.Config{
+			Email:     c.values["email"],
+			Password:  c.values["password"],
+			TokenFile: c.values["tokenFile"],
+		},
+	}
+	if v := c.values["sendCookie"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return s, fmt.Errorf("bad sendCookie value %q (from %s): %w", v, c.sources["sendCookie"], err)
+		}
+		s.SendCookie = b
+	}
+	return s, nil
+}
+
+// Mask hides all but the first character of a secret.
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	return value[:1] + strings.Repeat("*", 7)
+}
+
+// Print writes every key with its value and source, secrets are masked.
+func (c Config) Print(w io.Writer) {
+	for _, k := range Keys {
+		v, ok := c.values[k.Name]
+		if !ok {
+			fmt.Fprintf(w, "%s =\n", k.Name)
+			continue
+		}
+		if k.Secret {
+			v = Mask(v)
+		}
+		fmt.Fprintf(w, "%s = %s\t(%s)\n", k.Name, v, c.sources[k.Name])
+	}
+}
+
+// Write sets values in a config file, keeping the other keys already in it.
+// The format follows the extension, the file is readable by the owner only.
+func Write(filename string, values map[string]string) error {
+	return update(filename, func(raw map[string]interface{}) error {
+		return set(raw, values)
+	})
+}
+
+// WriteProfile sets values in the profile section of a config file, creating
+// the section if needed.
+func WriteProfile(filename, profile string, values map[string]string) error {
+	return update(filename, func(raw map[string]interface{}) error {
+		profiles, ok := raw["profiles"].(map[string]interface{})
+		if !ok {
+			if _, exists := raw["profiles"]; exists {
+				return fmt.Errorf("%s: profiles is not a table", filename)
+			}
+			profiles = make(map[string]interface{})
+			raw["profiles"] = profiles
+		}
+		p, ok := profiles[profile].(map[string]interface{})
+		if !ok {
+			if _, exists := profiles[profile]; exists {
+				return fmt.Errorf("%s: profile %s is not a table", filename, profile)
+			}
+			p = make(map[string]interface{})
+			profiles[profile] = p
+		}
+		return set(p, values)
+	})
+}
+
+// set stores values in raw, dropping differently spelled duplicates of the
+// keys being set.
+func set(raw map[string]interface{}, values map[string]string) error {
+	for name := range raw {
+		if k, err := Lookup(name); err == nil {
+			if _, ok := values[k.Name]; ok && name != k.Name {
+				delete(raw, name)
+			}
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		k, err := Lookup(name)
+		if err != nil {
+			return err
+		}
+		v := values[name]
+		if b, err := strconv.ParseBool(v); err == nil && k.Name == "sendCookie" {
+			raw[k.Name] = b
+		} else {
+			raw[k.Name] = v
+		}
+	}
+	return nil
+}
+
+// update reads a config file, lets fn change it and writes it back.
+func update(filename string, fn func(raw map[string]interface{}) error) error {
+	raw, err := readRaw(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		raw = make(map[string]interface{})
+	} else if err != nil {
+		return err
+	}
+	if err = fn(raw); err != nil {
+		return err
+	}
+
+	var data []byte
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(raw)
+	case ".toml":
+		var buf bytes.Buffer
+		err = toml.NewEncoder(&buf).Encode(raw)
+		data = buf.Bytes()
+	default:
+		data, err = json.MarshalIndent(raw, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filename, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(filename, 0600)
+}
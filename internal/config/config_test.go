@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLayers(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"user.yaml":    "email: user@example.com\npassword: from-yaml\nserver: https://yaml\n",
+		"project.toml": "password = \"from-toml\"\ntoken_file = \"/tmp/token.json\"\n",
+		"project.json": `{"Email": "json@example.com", "sendCookie": true, "unknown": 1}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var layers []Layer
+	for _, name := range []string{"user.yaml", "project.toml", "project.json"} {
+		l, err := File(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, l)
+	}
+	env := Env(func(name string) (string, bool) {
+		if name == "CIAC_SERVER" {
+			return "https://env", true
+		}
+		return "", false
+	})
+	c := Merge(append([]Layer{Defaults()}, append(layers, env)...)...)
+	s, err := c.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Settings{Server: "https://env"}
+	want.Email = "json@example.com"
+	want.Password = "from-toml"
+	want.TokenFile = "/tmp/token.json"
+	want.SendCookie = true
+	if s != want {
+		t.Errorf("settings = %+v, want %+v", s, want)
+	}
+	if _, source, _ := c.Get("password"); source != filepath.Join(dir, "project.toml") {
+		t.Errorf("password source = %s", source)
+	}
+	if _, err := Lookup("nothing"); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, ext := range []string{".json", ".yaml", ".toml"} {
+		filename := filepath.Join(t.TempDir(), "config"+ext)
+		if err := Write(filename, map[string]string{"email": "a@b.c", "sendCookie": "true"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Write(filename, map[string]string{"Password": "secret"}); err != nil {
+			t.Fatal(err)
+		}
+		l, err := File(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.Values["email"] != "a@b.c" || l.Values["password"] != "secret" || l.Values["sendCookie"] != "true" {
+			t.Errorf("%s: values = %v", ext, l.Values)
+		}
+		if info, _ := os.Stat(filename); info.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode = %s", ext, info.Mode())
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	content := `email: default@example.com
+profiles:
+  alice:
+    email: alice@example.com
+    password: secret
+environments:
+  local: http://localhost:8080
+invitationCodes: [AB12cd, XY34ab]
+accounts:
+  deposit:TRON:USDT: Assets:Tron:USDT
+`
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := File(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Merge(Defaults(), l)
+	if got := c.Profiles(); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("profiles = %v", got)
+	}
+	if got := c.Environments(); len(got) != 2 || got[0] != "local" || got[1] != "test" {
+		t.Errorf("environments = %v", got)
+	}
+	if got := c.InvitationCodes(); len(got) != 2 {
+		t.Errorf("invitation codes = %v", got)
+	}
+	if got := c.Accounts()["deposit:TRON:USDT"]; got != "Assets:Tron:USDT" {
+		t.Errorf("accounts = %v", c.Accounts())
+	}
+	p, err := c.Profile("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := c.Environment("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Merge(Defaults(), l, p, env).Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Email != "alice@example.com" || s.Password != "secret" || s.Server != "http://localhost:8080" {
+		t.Errorf("settings = %+v", s)
+	}
+	if _, err = c.Profile("bob"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	content := `email: default@example.com
+password: top
+profiles:
+  alice: {email: alice@example.com, password: old}
+`
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := File(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Merge(l).Profile("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin, err := Merge(Defaults(), l, p, Env(func(string) (string, bool) { return "", false })).Origin("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin.File != filename || origin.Profile != "alice" {
+		t.Fatalf("origin = %+v", origin)
+	}
+	if err = WriteProfile(origin.File, origin.Profile, map[string]string{"password": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = File(filename); err != nil {
+		t.Fatal(err)
+	}
+	if l.Values["password"] != "top" || l.Profiles["alice"]["password"] != "new" || l.Profiles["alice"]["email"] != "alice@example.com" {
+		t.Errorf("values = %v, profiles = %v", l.Values, l.Profiles)
+	}
+}
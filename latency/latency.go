@@ -0,0 +1,133 @@
+// Package latency analyses the delay between a deposit on chain (recharge
+// time) and its crediting by the server (arrival time).
+package latency
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+// Delay returns the crediting delay of a record. ok is false for records
+// which look pending: no arrival time, or one before the recharge time.
+func Delay(r client.RechargeRecord) (d time.Duration, ok bool) {
+	if r.ArrivalTime <= 0 || r.ArrivalTime < r.RechargeTime {
+		return 0, false
+	}
+	return time.Duration(r.ArrivalTime-r.RechargeTime) * time.Millisecond, true
+}
+
+// Group is the chain and symbol of a deposit.
+type Group struct {
+	Chain, Symbol string
+}
+
+// Outlier is a record with a delay above the outlier threshold of its group.
+type Outlier struct {
+	Record client.RechargeRecord
+	Delay  time.Duration
+}
+
+// Stats are the delays of a group.
+type Stats struct {
+	Group
+	Count                 int
+	Min, Median, P95, Max time.Duration
+	Threshold             time.Duration // delays above it are outliers
+	Outliers              []Outlier
+	Delays                []time.Duration // sorted
+}
+
+// Report of all groups, sorted by chain and symbol.
+type Report struct {
+	Groups  []Stats
+	Pending []client.RechargeRecord
+}
+
+// percentile returns the nearest-rank percentile of sorted delays.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// OutlierFactor times the median of a group is its default outlier threshold.
+const OutlierFactor = 3
+
+// Analyze groups records by chain and symbol. A delay above threshold is an
+// outlier, a zero threshold means OutlierFactor times the group's median.
+func Analyze(records []client.RechargeRecord, threshold time.Duration) Report {
+	var report Report
+	groups := make(map[Group][]client.RechargeRecord)
+	for _, r := range records {
+		if _, ok := Delay(r); !ok {
+			report.Pending = append(report.Pending, r)
+			continue
+		}
+		g := Group{r.Chain, r.Symbol}
+		groups[g] = append(groups[g], r)
+	}
+	for g, list := range groups {
+		s := Stats{Group: g, Count: len(list)}
+		for _, r := range list {
+			d, _ := Delay(r)
+			s.Delays = append(s.Delays, d)
+		}
+		sort.Slice(s.Delays, func(i, j int) bool { return s.Delays[i] < s.Delays[j] })
+		s.Min, s.Max = s.Delays[0], s.Delays[len(s.Delays)-1]
+		s.Median = percentile(s.Delays, 50)
+		s.P95 = percentile(s.Delays, 95)
+		s.Threshold = threshold
+		if s.Threshold == 0 {
+			s.Threshold = OutlierFactor * s.Median
+		}
+		for _, r := range list {
+			if d, _ := Delay(r); d > s.Threshold {
+				s.Outliers = append(s.Outliers, Outlier{r, d})
+			}
+		}
+		sort.Slice(s.Outliers, func(i, j int) bool { return s.Outliers[i].Delay > s.Outliers[j].Delay })
+		report.Groups = append(report.Groups, s)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.Chain != b.Chain {
+			return a.Chain < b.Chain
+		}
+		return a.Symbol < b.Symbol
+	})
+	return report
+}
+
+// Bucket counts the delays up to Upper, a zero Upper is the overflow bucket.
+type Bucket struct {
+	Upper time.Duration
+	Count int
+}
+
+// DefaultBuckets are the upper bounds used by the latency command.
+var DefaultBuckets = []time.Duration{
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// Histogram counts delays into buckets with the given upper bounds, plus an
+// overflow bucket.
+func Histogram(delays []time.Duration, bounds []time.Duration) []Bucket {
+	buckets := make([]Bucket, len(bounds)+1)
+	for i, b := range bounds {
+		buckets[i].Upper = b
+	}
+	for _, d := range delays {
+		i := sort.Search(len(bounds), func(i int) bool { return d <= bounds[i] })
+		buckets[i].Count++
+	}
+	return buckets
+}
@@ -0,0 +1,67 @@
+package latency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+func record(chain string, delay time.Duration) client.RechargeRecord {
+	const at = 1627392295000
+	return client.RechargeRecord{Chain: chain, Symbol: "USDT", RechargeTime: at, ArrivalTime: at + int64(delay/time.Millisecond)}
+}
+
+func TestAnalyze(t *testing.T) {
+	var records []client.RechargeRecord
+	for i := 1; i <= 19; i++ {
+		records = append(records, record("TRON", time.Duration(i)*time.Minute))
+	}
+	records = append(records,
+		record("TRON", 2*time.Hour),
+		record("ETH", 5*time.Minute),
+		client.RechargeRecord{Chain: "ETH", Symbol: "USDT", RechargeTime: 1627392295000},
+	)
+	r := Analyze(records, 0)
+	if len(r.Pending) != 1 || len(r.Groups) != 2 || r.Groups[0].Chain != "ETH" {
+		t.Fatalf("report = %+v", r)
+	}
+	tron := r.Groups[1]
+	if tron.Count != 20 || tron.Min != time.Minute || tron.Median != 10*time.Minute ||
+		tron.P95 != 19*time.Minute || tron.Max != 2*time.Hour {
+		t.Errorf("stats = %+v", tron)
+	}
+	if len(tron.Outliers) != 1 || tron.Outliers[0].Delay != 2*time.Hour {
+		t.Errorf("outliers = %+v", tron.Outliers)
+	}
+	if r = Analyze(records, 15*time.Minute); len(r.Groups[1].Outliers) != 5 {
+		t.Errorf("outliers above 15m = %+v", r.Groups[1].Outliers)
+	}
+
+	buckets := Histogram(tron.Delays, []time.Duration{5 * time.Minute, time.Hour})
+	if len(buckets) != 3 || buckets[0].Count != 5 || buckets[1].Count != 14 || buckets[2].Count != 1 {
+		t.Errorf("histogram = %+v", buckets)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 20)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Second
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Second},
+		{50, 10 * time.Second},
+		{50.000001, 11 * time.Second},
+		{95, 19 * time.Second},
+		{100, 20 * time.Second},
+	}
+	for i, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("[%d] p%v = %s, want %s", i, tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package plugins finds and runs the executables extending ciac: ciac-<name>
+// on PATH runs as "ciac <name>", like git and kubectl plugins.
+//
+// A plugin gets the effective configuration, the active profile and a fresh
+// token in CIAC_PLUGIN_* environment variables, or as a JSON Context on stdin.
+package plugins
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/internal/config"
+)
+
+// Prefix of plugin executables.
+const Prefix = "ciac-"
+
+// Plugin is an executable found on PATH.
+type Plugin struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// ShadowedBy is the path of the plugin of the same name found first
+	ShadowedBy string `json:"shadowedBy,omitempty"`
+}
+
+// executable tells if a file can be run, on Windows by its extension.
+func executable(dir string, fi os.FileInfo) bool {
+	if fi.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(fi.Name())) {
+		case ".exe", ".bat", ".cmd":
+			return true
+		}
+		return false
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		// Lstat of a link, check the target
+		target, err := os.Stat(filepath.Join(dir, fi.Name()))
+		return err == nil && !target.IsDir() && target.Mode()&0111 != 0
+	}
+	return fi.Mode()&0111 != 0
+}
+
+// dirs returns the directories of pathList, a PATH value, in order. Empty and
+// relative entries are skipped, like exec.LookPath does, so that a plugin in
+// the current directory does not run by accident.
+func dirs(pathList string) []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" || !filepath.IsAbs(dir) || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		list = append(list, dir)
+	}
+	return list
+}
+
+// Lookup finds the plugin name in the directories of pathList, ok is false
+// if there is none. Only the directories are searched until the first match,
+// unlike Find.
+func Lookup(name, pathList string) (p Plugin, ok bool) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return Plugin{}, false
+	}
+	files := []string{Prefix + name}
+	if runtime.GOOS == "windows" {
+		files = []string{Prefix + name + ".exe", Prefix + name + ".bat", Prefix + name + ".cmd"}
+	}
+	for _, dir := range dirs(pathList) {
+		for _, file := range files {
+			fi, err := os.Stat(filepath.Join(dir, file))
+			if err == nil && executable(dir, fi) {
+				return Plugin{Name: name, Path: filepath.Join(dir, file)}, true
+			}
+		}
+	}
+	return Plugin{}, false
+}
+
+// Find lists the plugins in the directories of pathList, a PATH value, in
+// PATH order. A plugin found again later is listed with ShadowedBy set, as
+// only the first one runs.
+func Find(pathList string) []Plugin {
+	var list []Plugin
+	first := make(map[string]string)
+	for _, dir := range dirs(pathList) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range files {
+			if !strings.HasPrefix(fi.Name(), Prefix) || !executable(dir, fi) {
+				continue
+			}
+			name := strings.TrimPrefix(fi.Name(), Prefix)
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if name == "" {
+				continue
+			}
+			p := Plugin{Name: name, Path: filepath.Join(dir, fi.Name())}
+			if path, ok := first[name]; ok {
+				p.ShadowedBy = path
+			} else {
+				first[name] = p.Path
+			}
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// Context is what a plugin gets from ciac.
+type Context struct {
+	Name    string `json:"name"`
+	Profile string `json:"profile,omitempty"`
+	// Config is the effective configuration by key name, without secrets
+	Config   map[string]string `json:"config"`
+	Token    string            `json:"token,omitempty"`
+	ExpireAt time.Time         `json:"expireAt"`
+}
+
+// NewContext keeps the values of cfg except the secret ones.
+func NewContext(name, profile string, cfg config.Config) Context {
+	ctx := Context{Name: name, Profile: profile, Config: make(map[string]string)}
+	for _, k := range config.Keys {
+		if v, _, _ := cfg.Get(k.Name); v != "" && !k.Secret {
+			ctx.Config[k.Name] = v
+		}
+	}
+	return ctx
+}
+
+// envName is the variable of a config key for plugins, CIAC_PLUGIN_SERVER
+// for CIAC_SERVER. The CIAC_* names themselves would override the profile of
+// a ciac run by the plugin.
+func envName(k config.Key) string {
+	return "CIAC_PLUGIN_" + strings.TrimPrefix(k.Env, "CIAC_")
+}
+
+// Env returns the context as environment variables.
+func (c Context) Env() []string {
+	env := []string{
+		"CIAC_PLUGIN_NAME=" + c.Name,
+		"CIAC_PLUGIN_PROFILE=" + c.Profile,
+		"CIAC_PLUGIN_TOKEN=" + c.Token,
+	}
+	if !c.ExpireAt.IsZero() {
+		env = append(env, "CIAC_PLUGIN_TOKEN_EXPIRE_AT="+c.ExpireAt.Format(time.RFC3339))
+	}
+	for _, k := range config.Keys {
+		if v, ok := c.Config[k.Name]; ok {
+			env = append(env, envName(k)+"="+v)
+		}
+	}
+	return env
+}
+
+// Command prepares the run of a plugin with args. The context is added to
+// env, with stdin it is also written as JSON to the plugin's stdin, which is
+// os.Stdin otherwise.
+func (p Plugin) Command(args []string, env []string, ctx Context, stdin bool) (*exec.Cmd, error) {
+	cmd := exec.Command(p.Path, args...)
+	cmd.Env = append(append(os.Environ(), env...), ctx.Env()...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if stdin {
+		data, err := json.Marshal(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	}
+	return cmd, nil
+}
@@ -0,0 +1,137 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caitan-app/ciac/internal/config"
+)
+
+func write(t *testing.T, filename string, mode os.FileMode) {
+	t.Helper()
+	if err := ioutil.WriteFile(filename, []byte("#!/bin/sh\nenv | grep ^CIAC_PLUGIN_ | sort\ncat\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executables are found by extension")
+	}
+	a, b := t.TempDir(), t.TempDir()
+	write(t, filepath.Join(a, "ciac-tag"), 0755)
+	write(t, filepath.Join(a, "ciac-notes"), 0644)
+	write(t, filepath.Join(a, "other"), 0755)
+	write(t, filepath.Join(b, "ciac-tag"), 0755)
+	write(t, filepath.Join(b, "ciac-sum"), 0700)
+	if err := os.Mkdir(filepath.Join(b, "ciac-dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(b, "ciac-sum"), filepath.Join(a, "ciac-total")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the current directory holds a plugin too, neither "" nor "." may find it
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(b); err != nil {
+		t.Fatal(err)
+	}
+	pathList := strings.Join([]string{a, "", filepath.Join(a, "missing"), ".", b, a}, string(os.PathListSeparator))
+
+	got := Find(pathList)
+	want := []Plugin{
+		{Name: "tag", Path: filepath.Join(a, "ciac-tag")},
+		{Name: "total", Path: filepath.Join(a, "ciac-total")},
+		{Name: "sum", Path: filepath.Join(b, "ciac-sum")},
+		{Name: "tag", Path: filepath.Join(b, "ciac-tag"), ShadowedBy: filepath.Join(a, "ciac-tag")},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("found %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("plugin %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	lookups := []struct {
+		name string
+		want Plugin
+		ok   bool
+	}{
+		{"tag", want[0], true},
+		{"sum", want[2], true},
+		{"notes", Plugin{}, false},
+		{"dir", Plugin{}, false},
+		{"../ciac-tag", Plugin{}, false},
+	}
+	for _, tt := range lookups {
+		if p, ok := Lookup(tt.name, pathList); p != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %+v, %v, want %+v, %v", tt.name, p, ok, tt.want, tt.ok)
+		}
+	}
+	if _, ok := Lookup("sum", "."+string(os.PathListSeparator)); ok {
+		t.Error("Lookup found a plugin in the current directory")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	cfg := config.Merge(config.Layer{Source: "test", Values: map[string]string{
+		"server":   "https://test.caitan.app",
+		"email":    "alice@example.com",
+		"password": "secret",
+	}})
+	ctx := NewContext("tag", "alice", cfg)
+	ctx.Token, ctx.ExpireAt = "jwt", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, ok := ctx.Config["password"]; ok {
+		t.Error("password passed to the plugin")
+	}
+
+	dir := t.TempDir()
+	p := Plugin{Name: "tag", Path: filepath.Join(dir, "ciac-tag")}
+	write(t, p.Path, 0755)
+	cmd, err := p.Command(nil, []string{"CIAC_PLUGIN_NAME=overridden"}, ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	env, doc := out.String(), ""
+	if i := strings.Index(env, "{"); i >= 0 {
+		env, doc = env[:i], env[i:]
+	}
+	wantEnv := `CIAC_PLUGIN_EMAIL=alice@example.com
+CIAC_PLUGIN_NAME=tag
+CIAC_PLUGIN_PROFILE=alice
+CIAC_PLUGIN_SERVER=https://test.caitan.app
+CIAC_PLUGIN_TOKEN=jwt
+CIAC_PLUGIN_TOKEN_EXPIRE_AT=2026-01-02T03:04:05Z
+`
+	if env != wantEnv {
+		t.Errorf("env =\n%s\nwant\n%s", env, wantEnv)
+	}
+	var got Context
+	if err := json.Unmarshal([]byte(doc), &got); err != nil {
+		t.Fatalf("stdin %q: %s", doc, err)
+	}
+	if got.Token != "jwt" || got.Profile != "alice" || got.Config["email"] != "alice@example.com" || !got.ExpireAt.Equal(ctx.ExpireAt) {
+		t.Errorf("stdin context = %+v", got)
+	}
+}
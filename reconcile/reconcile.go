@@ -0,0 +1,157 @@
+// Package reconcile matches the deposits credited by the server with the
+// transfers found on chain.
+package reconcile
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+// Transfer is a transfer exported from a block explorer or node.
+type Transfer struct {
+	Hash   string
+	From   string
+	To     string
+	Amount float64
+	Symbol string // empty if the export has no symbol column
+	Time   time.Time
+}
+
+// Options tune the matching.
+type Options struct {
+	// Window is the maximum difference between recharge and transfer time
+	Window time.Duration
+	// Tolerance is the maximum difference of amounts still considered equal
+	Tolerance float64
+	// Addresses are our deposit addresses, transfers to other addresses are
+	// ignored. Nil means all transfers are ours.
+	Addresses map[string]bool
+	// Start and End limit the unmatched transfers reported to the range the
+	// records were fetched for, zero means no limit. Transfers outside the
+	// range still match records within the window.
+	Start, End time.Time
+}
+
+// inRange reports whether t is within the range of opts.
+func (opts Options) inRange(t time.Time) bool {
+	return (opts.Start.IsZero() || !t.Before(opts.Start)) && (opts.End.IsZero() || t.Before(opts.End))
+}
+
+// Match is a deposit and the transfer it was matched with.
+type Match struct {
+	Record   client.RechargeRecord
+	Transfer Transfer
+}
+
+// Result of a reconciliation.
+type Result struct {
+	Matched    []Match
+	Mismatched []Match // same address and time window, different amount
+	ServerOnly []client.RechargeRecord
+	ChainOnly  []Transfer
+}
+
+// OK reports whether every deposit and transfer matched.
+func (r Result) OK() bool {
+	return len(r.Mismatched) == 0 && len(r.ServerOnly) == 0 && len(r.ChainOnly) == 0
+}
+
+// normalizeAddress makes hex addresses comparable, base58 ones are case
+// sensitive and kept.
+func normalizeAddress(a string) string {
+	a = strings.TrimSpace(a)
+	if strings.HasPrefix(a, "0x") || strings.HasPrefix(a, "0X") {
+		return strings.ToLower(a)
+	}
+	return a
+}
+
+func recordTime(r client.RechargeRecord) time.Time {
+	return time.Unix(r.RechargeTime/1000, r.RechargeTime%1000*int64(time.Millisecond))
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// Reconcile matches records with transfers to the same address within the
+// time window. Exact amounts are matched first, the closest in time wins;
+// the remaining pairs with different amounts are reported as mismatches.
+func Reconcile(records []client.RechargeRecord, transfers []Transfer, opts Options) Result {
+	addresses := make(map[string]bool)
+	for a := range opts.Addresses {
+		addresses[normalizeAddress(a)] = true
+	}
+	var ours []Transfer
+	for _, t := range transfers {
+		if opts.Addresses == nil || addresses[normalizeAddress(t.To)] {
+			ours = append(ours, t)
+		}
+	}
+	sorted := append([]client.RechargeRecord(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].RechargeTime < sorted[j].RechargeTime })
+
+	usedRecord := make([]bool, len(sorted))
+	usedTransfer := make([]bool, len(ours))
+	// best returns the unused transfer closest in time to r, -1 if none
+	best := func(r client.RechargeRecord, exact bool) int {
+		found, distance := -1, time.Duration(math.MaxInt64)
+		for j, t := range ours {
+			if usedTransfer[j] || normalizeAddress(t.To) != normalizeAddress(r.RechargeTo) {
+				continue
+			}
+			if t.Symbol != "" && r.Symbol != "" && !strings.EqualFold(t.Symbol, r.Symbol) {
+				continue
+			}
+			d := absDuration(t.Time.Sub(recordTime(r)))
+			if d > opts.Window {
+				continue
+			}
+			if exact != (math.Abs(t.Amount-r.Amount) <= opts.Tolerance) {
+				continue
+			}
+			if d < distance {
+				found, distance = j, d
+			}
+		}
+		return found
+	}
+
+	var result Result
+	for _, exact := range []bool{true, false} {
+		for i, r := range sorted {
+			if usedRecord[i] {
+				continue
+			}
+			j := best(r, exact)
+			if j < 0 {
+				continue
+			}
+			usedRecord[i], usedTransfer[j] = true, true
+			m := Match{Record: r, Transfer: ours[j]}
+			if exact {
+				result.Matched = append(result.Matched, m)
+			} else {
+				result.Mismatched = append(result.Mismatched, m)
+			}
+		}
+	}
+	for i, r := range sorted {
+		if !usedRecord[i] {
+			result.ServerOnly = append(result.ServerOnly, r)
+		}
+	}
+	for j, t := range ours {
+		if !usedTransfer[j] && opts.inRange(t.Time) {
+			result.ChainOnly = append(result.ChainOnly, t)
+		}
+	}
+	return result
+}
@@ -0,0 +1,67 @@
+package reconcile
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+const export = `"Txhash","UnixTimestamp","DateTime","From","To","Value","TokenSymbol"
+"0xa","1627392290","2021-07-27 13:24:50","0xf1","0xABC","30","USDT"
+"0xb","1627400000","2021-07-27 15:33:20","0xf2","0xabc","10","USDT"
+"0xc","1627500000","2021-07-28 19:20:00","0xf3","0xabc","5","USDT"
+"0xd","1627500000","2021-07-28 19:20:00","0xf4","0xother","1","USDT"
+`
+
+func TestReconcile(t *testing.T) {
+	transfers, err := ReadTransfers(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 4 || transfers[0].Hash != "0xa" || transfers[0].Time.Unix() != 1627392290 {
+		t.Fatalf("transfers = %+v", transfers)
+	}
+	records := []client.RechargeRecord{
+		{RechargeTo: "0xabc", Amount: 30, Symbol: "USDT", RechargeTime: 1627392295000},
+		{RechargeTo: "0xabc", Amount: 9.5, Symbol: "USDT", RechargeTime: 1627400010000},
+		{RechargeTo: "0xabc", Amount: 7, Symbol: "USDT", RechargeTime: 1627900000000},
+	}
+	r := Reconcile(records, transfers, Options{
+		Window:    time.Hour,
+		Tolerance: 1e-6,
+		Addresses: map[string]bool{"0xAbC": true},
+	})
+	if len(r.Matched) != 1 || r.Matched[0].Transfer.Hash != "0xa" {
+		t.Errorf("matched = %+v", r.Matched)
+	}
+	if len(r.Mismatched) != 1 || r.Mismatched[0].Transfer.Hash != "0xb" {
+		t.Errorf("mismatched = %+v", r.Mismatched)
+	}
+	if len(r.ServerOnly) != 1 || r.ServerOnly[0].Amount != 7 {
+		t.Errorf("server only = %+v", r.ServerOnly)
+	}
+	// 0xd goes to an address which is not ours
+	if len(r.ChainOnly) != 1 || r.ChainOnly[0].Hash != "0xc" {
+		t.Errorf("chain only = %+v", r.ChainOnly)
+	}
+	if r.OK() {
+		t.Error("result is OK")
+	}
+
+	// all transfers count as ours, 0xc and 0xd are after the end
+	r = Reconcile(records[:2], transfers, Options{
+		Window:    time.Hour,
+		Tolerance: 1e-6,
+		Start:     time.Unix(1627390000, 0),
+		End:       time.Unix(1627450000, 0),
+	})
+	if len(r.Matched) != 1 || len(r.Mismatched) != 1 || len(r.ChainOnly) != 0 {
+		t.Errorf("in range: %+v", r)
+	}
+
+	if _, err = ReadTransfers(strings.NewReader("hash,amount,time\n")); err == nil {
+		t.Error("missing to column accepted")
+	}
+}
@@ -0,0 +1,104 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// columns are the accepted header names of each field, as used by common
+// block explorer exports.
+var columns = map[string][]string{
+	"hash":   {"hash", "txid", "txhash", "transaction hash", "txn hash"},
+	"from":   {"from"},
+	"to":     {"to"},
+	"amount": {"amount", "value", "quantity"},
+	"symbol": {"symbol", "token", "tokensymbol", "token symbol"},
+	"time":   {"time", "timestamp", "datetime", "date", "block time", "unixtimestamp"},
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseTime accepts the layouts above, Unix seconds or Unix milliseconds.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e11 { // ms
+			return time.Unix(n/1000, n%1000*int64(time.Millisecond)), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("bad time %q", s)
+}
+
+// ReadTransfers reads a CSV export of transfers with a header row. The to,
+// amount and time columns are required; hash, from and symbol are optional.
+// Times without zone are UTC, as explorers export them.
+func ReadTransfers(r io.Reader) ([]Transfer, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.Trim(strings.TrimSpace(name), `"`))
+		for field, names := range columns {
+			for _, n := range names {
+				if _, ok := index[field]; !ok && name == n {
+					index[field] = i
+				}
+			}
+		}
+	}
+	for _, field := range []string{"to", "amount", "time"} {
+		if _, ok := index[field]; !ok {
+			return nil, fmt.Errorf("missing column %q", field)
+		}
+	}
+	get := func(record []string, field string) string {
+		if i, ok := index[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var transfers []Transfer
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return transfers, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := Transfer{
+			Hash:   get(record, "hash"),
+			From:   get(record, "from"),
+			To:     get(record, "to"),
+			Symbol: get(record, "symbol"),
+		}
+		amount := strings.ReplaceAll(get(record, "amount"), ",", "")
+		if t.Amount, err = strconv.ParseFloat(amount, 64); err != nil {
+			return nil, fmt.Errorf("line %d: bad amount: %w", line, err)
+		}
+		if t.Time, err = parseTime(get(record, "time")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		transfers = append(transfers, t)
+	}
+}
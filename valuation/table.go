@@ -0,0 +1,164 @@
+package valuation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type point struct {
+	at    time.Time
+	price float64
+}
+
+// Table is a Source backed by a table of historical prices. The price at a
+// time is the one of the nearest previous point.
+type Table struct {
+	points map[string][]point // SYMBOL/FIAT => points sorted by time
+}
+
+func tableKey(symbol, fiat string) string {
+	return strings.ToUpper(symbol) + "/" + strings.ToUpper(fiat)
+}
+
+// Add adds a price, an empty fiat means the price is valid for any fiat.
+func (t *Table) Add(symbol, fiat string, at time.Time, price float64) {
+	if t.points == nil {
+		t.points = make(map[string][]point)
+	}
+	k := tableKey(symbol, fiat)
+	points := t.points[k]
+	i := sort.Search(len(points), func(i int) bool { return points[i].at.After(at) })
+	points = append(points, point{})
+	copy(points[i+1:], points[i:])
+	points[i] = point{at, price}
+	t.points[k] = points
+}
+
+func (t *Table) Price(symbol, fiat string, at time.Time) (float64, error) {
+	for _, k := range []string{tableKey(symbol, fiat), tableKey(symbol, "")} {
+		points := t.points[k]
+		i := sort.Search(len(points), func(i int) bool { return points[i].at.After(at) })
+		if i > 0 {
+			return points[i-1].price, nil
+		}
+	}
+	return 0, fmt.Errorf("%w for %s in %s at %s", ErrNoPrice, symbol, fiat, at.Format(time.RFC3339))
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseTime accepts the layouts above or a Unix time in ms.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)), nil
+	}
+	return time.Time{}, fmt.Errorf("bad time %q", s)
+}
+
+// row is a price in a JSON table, time is a string as in a CSV table.
+type row struct {
+	Time   string  `json:"time"`
+	Symbol string  `json:"symbol"`
+	Fiat   string  `json:"fiat"`
+	Price  float64 `json:"price"`
+}
+
+// LoadTable reads a price table, the format is chosen by the extension.
+//
+// A CSV table has the columns time, symbol, price and optionally fiat, in any
+// order after a header row. A JSON table is an array of objects with the same
+// keys. Times are RFC 3339, "2006-01-02 15:04:05", "2006-01-02" or ms.
+func LoadTable(filename string) (*Table, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return ReadJSON(f)
+	}
+	return ReadCSV(f)
+}
+
+// ReadJSON reads a JSON price table.
+func ReadJSON(r io.Reader) (*Table, error) {
+	var rows []row
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, err
+	}
+	t := &Table{}
+	for i, row := range rows {
+		if err := t.addRow(row); err != nil {
+			return nil, fmt.Errorf("price %d: %w", i+1, err)
+		}
+	}
+	return t, nil
+}
+
+// ReadCSV reads a CSV price table.
+func ReadCSV(r io.Reader) (*Table, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"time", "symbol", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	t := &Table{}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := row{Time: record[columns["time"]], Symbol: record[columns["symbol"]]}
+		if i, ok := columns["fiat"]; ok {
+			row.Fiat = record[i]
+		}
+		if row.Price, err = strconv.ParseFloat(record[columns["price"]], 64); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err = t.addRow(row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+func (t *Table) addRow(r row) error {
+	at, err := parseTime(r.Time)
+	if err != nil {
+		return err
+	}
+	if r.Symbol == "" {
+		return fmt.Errorf("missing symbol")
+	}
+	t.Add(r.Symbol, r.Fiat, at, r.Price)
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package valuation values deposits in fiat from historical prices.
+package valuation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+// ErrNoPrice is returned when a source has no price for a symbol at a time.
+var ErrNoPrice = errors.New("no price")
+
+// Source provides the price of one unit of symbol in fiat at a time.
+type Source interface {
+	Price(symbol, fiat string, at time.Time) (float64, error)
+}
+
+// Deposit is a recharge record valued in fiat, Err is set when the price is
+// unknown.
+type Deposit struct {
+	client.RechargeRecord
+	Time  time.Time
+	Price float64
+	Value float64
+	Err   error
+}
+
+// Value values recharge records at the price of their symbol at recharge time.
+func Value(records []client.RechargeRecord, source Source, fiat string) []Deposit {
+	deposits := make([]Deposit, 0, len(records))
+	for _, r := range records {
+		d := Deposit{RechargeRecord: r, Time: time.Unix(r.RechargeTime/1000, r.RechargeTime%1000*int64(time.Millisecond))}
+		d.Price, d.Err = source.Price(r.Symbol, fiat, d.Time)
+		if d.Err == nil {
+			d.Value = r.Amount * d.Price
+		}
+		deposits = append(deposits, d)
+	}
+	sort.SliceStable(deposits, func(i, j int) bool {
+		return deposits[i].Time.Before(deposits[j].Time)
+	})
+	return deposits
+}
+
+// Periods are the names accepted by PeriodOf.
+var Periods = []string{"day", "week", "month", "year"}
+
+// PeriodOf returns the name of the period containing t, e.g. 2021-07,
+// 2021-W30.
+func PeriodOf(period string, t time.Time) (string, error) {
+	switch period {
+	case "day":
+		return t.Format("2006-01-02"), nil
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), nil
+	case "month":
+		return t.Format("2006-01"), nil
+	case "year":
+		return t.Format("2006"), nil
+	}
+	return "", fmt.Errorf("unknown period %q, valid periods are %s", period, strings.Join(Periods, ", "))
+}
+
+// Total is the fiat value of the deposits of a period.
+type Total struct {
+	Period   string
+	Count    int
+	Value    float64
+	BySymbol map[string]float64
+	Unpriced int // deposits without a price, not part of Value
+}
+
+// Totals sums deposits per period, in order of time.
+func Totals(deposits []Deposit, period string) ([]Total, error) {
+	var totals []Total
+	index := make(map[string]int)
+	for _, d := range deposits {
+		name, err := PeriodOf(period, d.Time)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(totals)
+			index[name] = i
+			totals = append(totals, Total{Period: name, BySymbol: make(map[string]float64)})
+		}
+		t := &totals[i]
+		t.Count++
+		if d.Err != nil {
+			t.Unpriced++
+			continue
+		}
+		t.Value += d.Value
+		t.BySymbol[d.Symbol] += d.Value
+	}
+	return totals, nil
+}
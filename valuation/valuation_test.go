@@ -0,0 +1,90 @@
+package valuation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caitan-app/ciac/client"
+)
+
+const prices = `time,symbol,fiat,price
+2021-07-01,USDT,USD,1.00
+2021-07-20,USDT,USD,0.99
+2021-07-01,USDT,EUR,0.84
+2021-07-01 12:00:00,DAI,,1.01
+`
+
+func ms(s string) int64 {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func TestTable(t *testing.T) {
+	table, err := ReadCSV(strings.NewReader(prices))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		symbol, fiat, at string
+		want             float64
+		err              error
+	}{
+		{"USDT", "USD", "2021-07-10 00:00:00", 1.00, nil},
+		{"USDT", "USD", "2021-07-20 00:00:00", 0.99, nil},
+		{"usdt", "eur", "2021-08-01 00:00:00", 0.84, nil},
+		{"DAI", "USD", "2021-07-02 00:00:00", 1.01, nil},
+		{"DAI", "USD", "2021-07-01 11:00:00", 0, ErrNoPrice},
+		{"USDC", "USD", "2021-07-10 00:00:00", 0, ErrNoPrice},
+	}
+	for i, tt := range tests {
+		at := time.Unix(ms(tt.at)/1000, 0)
+		got, err := table.Price(tt.symbol, tt.fiat, at)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("[%d] Price(%s, %s, %s) = %v, %v, want %v, %v", i, tt.symbol, tt.fiat, tt.at, got, err, tt.want, tt.err)
+		}
+	}
+
+	json := `[{"time":"2021-07-01","symbol":"USDT","fiat":"USD","price":1}]`
+	if table, err = ReadJSON(strings.NewReader(json)); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := table.Price("USDT", "USD", time.Now()); p != 1 || err != nil {
+		t.Errorf("json: %v, %v", p, err)
+	}
+	if _, err = ReadCSV(strings.NewReader("date,symbol,price\n")); err == nil {
+		t.Error("missing time column accepted")
+	}
+}
+
+func TestTotals(t *testing.T) {
+	table, err := ReadCSV(strings.NewReader(prices))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []client.RechargeRecord{
+		{Symbol: "USDT", Amount: 100, RechargeTime: ms("2021-07-25 10:00:00")},
+		{Symbol: "USDT", Amount: 50, RechargeTime: ms("2021-07-05 10:00:00")},
+		{Symbol: "DAI", Amount: 10, RechargeTime: ms("2021-08-02 10:00:00")},
+		{Symbol: "BUSD", Amount: 10, RechargeTime: ms("2021-08-03 10:00:00")},
+	}
+	deposits := Value(records, table, "USD")
+	if deposits[0].Value != 50 || deposits[1].Value != 99 || deposits[3].Err == nil {
+		t.Errorf("deposits = %+v", deposits)
+	}
+	totals, err := Totals(deposits, "month")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 2 || totals[0].Period != "2021-07" || totals[0].Value != 149 ||
+		totals[1].Count != 2 || totals[1].Unpriced != 1 || totals[1].BySymbol["DAI"] != 10.1 {
+		t.Errorf("totals = %+v", totals)
+	}
+	if _, err = Totals(deposits, "fortnight"); err == nil {
+		t.Error("unknown period accepted")
+	}
+}